@@ -70,3 +70,63 @@ func normalizeSuite(suite string) string {
 func normalizeCity(city string) string {
 	return strings.ToLower(city)
 }
+
+var suiteSuffixRegex = regexp.MustCompile(`(?i)[,\s]+((?:suite|ste\.?|room|rm\.?|unit|#)\s*[\w\.-]+)$`)
+
+// splitSuite separates a trailing suite or room from a street address, since we keep suites in
+// their own field
+func splitSuite(address string) (string, string) {
+	address = strings.TrimSpace(address)
+	match := suiteSuffixRegex.FindStringSubmatchIndex(address)
+	if match == nil {
+		return address, ""
+	}
+
+	return strings.TrimSpace(address[:match[0]]), address[match[2]:match[3]]
+}
+
+// officeInfoKey identifies an office by its normalized address, city and suite so the same office
+// found by different extractions compares equal
+func officeInfoKey(office OfficeInfo) string {
+	return normalizeAddress(office.Address) + "|" + normalizeCity(office.City) + "|" + normalizeSuite(office.Suite)
+}
+
+// dedupeOffices drops offices with the same key as an earlier one, keeping the first but filling in
+// any contact details it's missing from the later ones
+func dedupeOffices(offices []OfficeInfo) []OfficeInfo {
+	seen := map[string]int{}
+	var deduped []OfficeInfo
+	for _, office := range offices {
+		key := officeInfoKey(office)
+		if i, ok := seen[key]; ok {
+			fillOfficeInfo(&deduped[i], office)
+			continue
+		}
+		seen[key] = len(deduped)
+		deduped = append(deduped, office)
+	}
+
+	return deduped
+}
+
+func fillOfficeInfo(office *OfficeInfo, other OfficeInfo) {
+	fields := []struct {
+		dst *string
+		src string
+	}{
+		{&office.Building, other.Building},
+		{&office.State, other.State},
+		{&office.Zip, other.Zip},
+		{&office.Phone, other.Phone},
+		{&office.Fax, other.Fax},
+		{&office.Hours, other.Hours},
+	}
+	for _, field := range fields {
+		if *field.dst == "" {
+			*field.dst = field.src
+		}
+	}
+	if office.OpeningHours == nil {
+		office.OpeningHours = other.OpeningHours
+	}
+}
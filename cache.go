@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const DefaultCacheDir = ".cache/pages"
+
+// PageCache keeps raw html from member sites on disk so re-runs can revalidate with conditional
+// requests instead of downloading everything again. Bodies are stored by the hash of their content
+// and a small index entry per url points at the current body along with its validators. Only the
+// current body of each url is kept
+type PageCache struct {
+	Dir string
+	// entries fetched more recently than this are served without any request
+	TTL time.Duration
+	// only serve from the cache, never make a request
+	Offline bool
+}
+
+// the cache used by getPageSource, nil when caching is disabled
+var pageCache *PageCache
+
+type cacheEntry struct {
+	URL          string    `json:"url"`
+	BodyHash     string    `json:"body_hash"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	FetchedAt    time.Time `json:"fetched_at"`
+}
+
+func hashString(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *PageCache) indexPath(pageURL string) string {
+	return filepath.Join(c.Dir, "index", hashString(pageURL)+".json")
+}
+
+func (c *PageCache) bodyPath(bodyHash string) string {
+	return filepath.Join(c.Dir, "bodies", bodyHash+".html")
+}
+
+// Get returns the page at pageURL, from the cache when it's fresh or the server says it hasn't
+// changed, and from the network otherwise
+func (c *PageCache) Get(ctx context.Context, pageURL string) (string, error) {
+	entry, body, err := c.load(pageURL)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	cached := err == nil
+
+	if c.Offline {
+		if !cached {
+			return "", fmt.Errorf("%s is not in the cache and we're offline", pageURL)
+		}
+		return body, nil
+	}
+	if cached && c.TTL > 0 && time.Since(entry.FetchedAt) < c.TTL {
+		return body, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return "", err
+	}
+	if cached {
+		if entry.ETag != "" {
+			req.Header.Set("If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			req.Header.Set("If-Modified-Since", entry.LastModified)
+		}
+	}
+
+	err = limits.waitForFetch(req.Context(), pageURL)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := pageClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotModified && cached {
+		entry.FetchedAt = time.Now()
+		return body, c.saveEntry(entry)
+	}
+	if res.StatusCode != 200 {
+		return "", &statusError{URL: pageURL, StatusCode: res.StatusCode}
+	}
+
+	html, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+
+	err = c.store(cacheEntry{
+		URL:          pageURL,
+		ETag:         res.Header.Get("ETag"),
+		LastModified: res.Header.Get("Last-Modified"),
+		FetchedAt:    time.Now(),
+	}, string(html))
+	if err != nil {
+		return "", err
+	}
+
+	return string(html), nil
+}
+
+func (c *PageCache) load(pageURL string) (cacheEntry, string, error) {
+	entry, err := c.loadEntry(pageURL)
+	if err != nil {
+		return entry, "", err
+	}
+
+	body, err := os.ReadFile(c.bodyPath(entry.BodyHash))
+	if err != nil {
+		return entry, "", err
+	}
+
+	return entry, string(body), nil
+}
+
+func (c *PageCache) loadEntry(pageURL string) (cacheEntry, error) {
+	var entry cacheEntry
+
+	data, err := os.ReadFile(c.indexPath(pageURL))
+	if err != nil {
+		return entry, err
+	}
+	err = json.Unmarshal(data, &entry)
+	if err != nil {
+		return entry, fmt.Errorf("error parsing cache entry for %s: %v", pageURL, err)
+	}
+
+	return entry, nil
+}
+
+// store saves a new body for a url and removes the one it replaces, so pages that change on every
+// request don't fill the disk. Bodies are almost never shared between urls, and when one is a url
+// that loses it just fetches its page again
+func (c *PageCache) store(entry cacheEntry, body string) error {
+	entry.BodyHash = hashString(body)
+	previous, err := c.loadEntry(entry.URL)
+	replaced := err == nil && previous.BodyHash != entry.BodyHash
+
+	err = os.MkdirAll(filepath.Dir(c.bodyPath(entry.BodyHash)), 0755)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(c.bodyPath(entry.BodyHash), []byte(body), 0644)
+	if err != nil {
+		return err
+	}
+
+	err = c.saveEntry(entry)
+	if err != nil {
+		return err
+	}
+	if replaced {
+		err = os.Remove(c.bodyPath(previous.BodyHash))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *PageCache) saveEntry(entry cacheEntry) error {
+	err := os.MkdirAll(filepath.Dir(c.indexPath(entry.URL)), 0755)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(c.indexPath(entry.URL), data, 0644)
+}
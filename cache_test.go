@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPageCacheConditionalRequests(t *testing.T) {
+	requests := 0
+	conditional := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			conditional++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprint(w, "<html>offices</html>")
+	}))
+	defer server.Close()
+
+	cache := &PageCache{Dir: t.TempDir()}
+
+	for i := 0; i < 2; i++ {
+		body, err := cache.Get(context.Background(), server.URL)
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		if body != "<html>offices</html>" {
+			t.Errorf("Get() = %q on request %d", body, i)
+		}
+	}
+	if requests != 2 || conditional != 1 {
+		t.Errorf("expected 2 requests with 1 conditional, got %d and %d", requests, conditional)
+	}
+
+	cache.TTL = time.Hour
+	if _, err := cache.Get(context.Background(), server.URL); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("expected a fresh entry to skip the request, got %d requests", requests)
+	}
+
+	cache.Offline = true
+	if _, err := cache.Get(context.Background(), server.URL+"/missing"); err == nil {
+		t.Errorf("expected an error for an uncached page while offline")
+	}
+}
+
+func TestPageCacheReplacesBodies(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		// a page with a token that changes on every request
+		fmt.Fprintf(w, "<html>offices %d</html>", requests)
+	}))
+	defer server.Close()
+
+	cache := &PageCache{Dir: t.TempDir()}
+	for i := 0; i < 3; i++ {
+		if _, err := cache.Get(context.Background(), server.URL); err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+	}
+
+	bodies, err := os.ReadDir(filepath.Join(cache.Dir, "bodies"))
+	if err != nil {
+		t.Fatalf("ReadDir() error = %v", err)
+	}
+	if len(bodies) != 1 {
+		t.Errorf("expected only the current body to be kept, got %d", len(bodies))
+	}
+	cache.Offline = true
+	if body, err := cache.Get(context.Background(), server.URL); err != nil || body != "<html>offices 3</html>" {
+		t.Errorf("Get() = %q, %v, expected the latest body", body, err)
+	}
+}
+
+func TestListCurrentLegislatorsOffline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "- id: {bioguide: A000001}\n  terms: [{type: rep, start: '2025-01-03', end: '2999-01-03', state: IL, url: 'https://a.house.gov'}]\n")
+	}))
+	defer server.Close()
+
+	defer func(url string, cache *PageCache) { legislatorsURL, pageCache = url, cache }(legislatorsURL, pageCache)
+	legislatorsURL = server.URL
+	pageCache = &PageCache{Dir: t.TempDir(), Offline: true}
+
+	if _, err := listCurrentLegislators(context.Background()); err == nil {
+		t.Errorf("expected an error listing legislators offline with nothing cached")
+	}
+
+	pageCache.Offline = false
+	if _, err := listCurrentLegislators(context.Background()); err != nil {
+		t.Fatalf("listCurrentLegislators() error = %v", err)
+	}
+
+	// once cached the list no longer needs the network
+	server.Close()
+	pageCache.Offline = true
+	legislators, err := listCurrentLegislators(context.Background())
+	if err != nil {
+		t.Fatalf("listCurrentLegislators() offline error = %v", err)
+	}
+	if len(legislators) != 1 || legislators[0].Bioguide != "A000001" || legislators[0].State != "IL" {
+		t.Errorf("expected the cached legislator, got %+v", legislators)
+	}
+}
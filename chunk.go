@@ -0,0 +1,116 @@
+package main
+
+import (
+	"strings"
+)
+
+// pages bigger than this many estimated tokens are extracted a piece at a time, small enough that
+// a page full of offices doesn't run into the model's output limit
+const DefaultChunkTokens = 6000
+
+// how much each chunk repeats the end of the previous one, enough for an address block cut in two
+// to show up whole in one of them
+const chunkOverlapTokens = 150
+
+// splitIntoChunks splits page text into pieces of about maxTokens, breaking between lines and
+// overlapping by a few lines so no office is only ever seen cut in half. Zero maxTokens means no
+// splitting
+func splitIntoChunks(text string, maxTokens int) []string {
+	if maxTokens <= 0 || estimateTokens(text) <= maxTokens {
+		return []string{text}
+	}
+	overlap := chunkOverlapTokens
+	if overlap > maxTokens/4 {
+		overlap = maxTokens / 4
+	}
+
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		lines = append(lines, splitLongLine(line, maxTokens)...)
+	}
+
+	var chunks []string
+	var current []string
+	currentTokens := 0
+	for _, line := range lines {
+		lineTokens := estimateTokens(line)
+		if currentTokens+lineTokens > maxTokens && len(current) > 0 {
+			chunks = append(chunks, strings.Join(current, "\n"))
+
+			// start the next chunk with the last few lines of this one
+			var carried []string
+			carriedTokens := 0
+			for i := len(current) - 1; i >= 0; i-- {
+				carriedTokens += estimateTokens(current[i])
+				if carriedTokens > overlap {
+					break
+				}
+				carried = append([]string{current[i]}, carried...)
+			}
+			current = carried
+			currentTokens = 0
+			for _, carriedLine := range carried {
+				currentTokens += estimateTokens(carriedLine)
+			}
+		}
+		current = append(current, line)
+		currentTokens += lineTokens
+	}
+	if len(current) > 0 {
+		chunks = append(chunks, strings.Join(current, "\n"))
+	}
+
+	return chunks
+}
+
+// splitLongLine breaks a line too long for one chunk at spaces, which happens with pages that
+// put everything in one paragraph
+func splitLongLine(line string, maxTokens int) []string {
+	if estimateTokens(line) <= maxTokens {
+		return []string{line}
+	}
+
+	var pieces []string
+	var current []string
+	currentTokens := 0
+	for _, word := range strings.Fields(line) {
+		wordTokens := estimateTokens(word + " ")
+		if currentTokens+wordTokens > maxTokens && len(current) > 0 {
+			pieces = append(pieces, strings.Join(current, " "))
+			current = nil
+			currentTokens = 0
+		}
+		current = append(current, word)
+		currentTokens += wordTokens
+	}
+	if len(current) > 0 {
+		pieces = append(pieces, strings.Join(current, " "))
+	}
+
+	return pieces
+}
+
+// mergeChunkOffices combines the offices extracted from each chunk of a page. The same office
+// often comes back from two overlapping chunks, sometimes missing details in the one where it was
+// cut off, so duplicates are merged and partial offices dropped when a complete one has the
+// same address
+func mergeChunkOffices(offices []OfficeInfo) []OfficeInfo {
+	offices = dedupeOffices(offices)
+
+	complete := map[string]bool{}
+	for _, office := range offices {
+		if office.City != "" {
+			complete[normalizeAddress(office.Address)] = true
+		}
+	}
+
+	var merged []OfficeInfo
+	for _, office := range offices {
+		if office.City == "" && complete[normalizeAddress(office.Address)] {
+			continue
+		}
+		merged = append(merged, office)
+	}
+
+	return merged
+}
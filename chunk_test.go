@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSplitIntoChunks(t *testing.T) {
+	var lines []string
+	for i := 0; i < 200; i++ {
+		lines = append(lines, fmt.Sprintf("%d Main Street, Springfield, IL 62701", i))
+	}
+	text := strings.Join(lines, "\n")
+
+	if chunks := splitIntoChunks(text, 0); len(chunks) != 1 || chunks[0] != text {
+		t.Errorf("expected no splitting with zero max tokens, got %d chunks", len(chunks))
+	}
+
+	chunks := splitIntoChunks(text, 500)
+	if len(chunks) < 4 {
+		t.Fatalf("expected several chunks, got %d", len(chunks))
+	}
+	for i, chunk := range chunks {
+		if tokens := estimateTokens(chunk); tokens > 500+chunkOverlapTokens {
+			t.Errorf("chunk %d has %d tokens, expected at most about 500", i, tokens)
+		}
+		if i > 0 {
+			previous := strings.Split(chunks[i-1], "\n")
+			if !strings.Contains(chunk, previous[len(previous)-1]+"\n") {
+				t.Errorf("expected chunk %d to overlap the end of chunk %d", i, i-1)
+			}
+		}
+	}
+	for _, line := range lines {
+		found := false
+		for _, chunk := range chunks {
+			if strings.Contains(chunk, line) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("line %q missing from every chunk", line)
+		}
+	}
+
+	long := strings.Repeat("word ", 1000)
+	for _, chunk := range splitIntoChunks(long, 100) {
+		if estimateTokens(chunk) > 100+chunkOverlapTokens {
+			t.Errorf("expected a long line to be split, got a chunk of %d tokens", estimateTokens(chunk))
+		}
+	}
+}
+
+func TestMergeChunkOffices(t *testing.T) {
+	offices := []OfficeInfo{
+		{Address: "100 Main Street", City: "Springfield", State: "IL", Zip: "62701"},
+		// the same office from the next chunk, with the phone the first chunk cut off
+		{Address: "100 Main St", City: "Springfield", State: "IL", Zip: "62701", Phone: "(217) 555-0100"},
+		// cut off before the city
+		{Address: "100 Main Street"},
+		{Address: "1 Independence Ave SE", City: "Washington", State: "DC", Zip: "20515"},
+	}
+
+	merged := mergeChunkOffices(offices)
+	if len(merged) != 2 {
+		t.Fatalf("expected 2 offices, got %+v", merged)
+	}
+	if merged[0].Phone != "(217) 555-0100" {
+		t.Errorf("expected the duplicate's phone to be kept, got %+v", merged[0])
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sync"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// ModelPrice is what a model costs in US dollars per million tokens
+type ModelPrice struct {
+	PromptPerMillion     float64 `json:"prompt_per_million"`
+	CompletionPerMillion float64 `json:"completion_per_million"`
+}
+
+// list prices as of this writing, override them with a price table file when they change
+var DefaultModelPrices = map[string]ModelPrice{
+	openai.GPT4oMini: {PromptPerMillion: 0.15, CompletionPerMillion: 0.60},
+	openai.GPT4o:     {PromptPerMillion: 2.50, CompletionPerMillion: 10.00},
+}
+
+func (p ModelPrice) Cost(usage TokenUsage) float64 {
+	return (float64(usage.PromptTokens)*p.PromptPerMillion + float64(usage.CompletionTokens)*p.CompletionPerMillion) / 1e6
+}
+
+// loadPriceTable reads a json object of model names to prices, on top of the defaults
+func loadPriceTable(path string) (map[string]ModelPrice, error) {
+	prices := map[string]ModelPrice{}
+	for model, price := range DefaultModelPrices {
+		prices[model] = price
+	}
+	if path == "" {
+		return prices, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading price table: %v", err)
+	}
+	var fromFile map[string]ModelPrice
+	err = json.Unmarshal(data, &fromFile)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing price table: %v", err)
+	}
+	for model, price := range fromFile {
+		prices[model] = price
+	}
+
+	return prices, nil
+}
+
+// modelPrice looks up the price of the model a run uses. Without one every request costs $0, which
+// is only a problem when there's a spending cap that would then never be reached
+func modelPrice(prices map[string]ModelPrice, model string, maxCost float64) (ModelPrice, error) {
+	price, ok := prices[model]
+	if ok {
+		return price, nil
+	}
+	if maxCost > 0 {
+		return price, fmt.Errorf("no price known for model %s so -max-cost can't be enforced, add it with -price-table", model)
+	}
+
+	log.Printf("no price known for model %s, costs will show as $0", model)
+	return price, nil
+}
+
+// spendTracker adds up the tokens and cost of every llm request in a run, and tells the scraper
+// when it's time to stop starting new extractions
+type spendTracker struct {
+	mu    sync.Mutex
+	price ModelPrice
+	// zero means no limit
+	maxCost float64
+	usage   TokenUsage
+	cost    float64
+}
+
+// the run's spending, added to by getLLMResponse
+var spending = &spendTracker{}
+
+func newSpendTracker(price ModelPrice, maxCost float64) *spendTracker {
+	return &spendTracker{price: price, maxCost: maxCost}
+}
+
+func (s *spendTracker) add(usage TokenUsage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.usage.Add(usage)
+	s.cost += s.price.Cost(usage)
+}
+
+// exhausted reports whether the run has spent its budget. Requests already underway still
+// finish, so a run can go over the cap by a few legislators' worth
+func (s *spendTracker) exhausted() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.maxCost > 0 && s.cost >= s.maxCost
+}
+
+// costOf prices some usage at the run's model price, rounded to a hundredth of a cent
+func (s *spendTracker) costOf(usage TokenUsage) float64 {
+	return math.Round(s.price.Cost(usage)*1e4) / 1e4
+}
+
+func (s *spendTracker) logTotals() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	log.Printf("used %d llm requests, %d prompt tokens and %d completion tokens, about $%.4f", s.usage.Requests, s.usage.PromptTokens, s.usage.CompletionTokens, s.cost)
+	if s.maxCost > 0 && s.cost >= s.maxCost {
+		log.Printf("reached the spending cap of $%.4f", s.maxCost)
+	}
+}
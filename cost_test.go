@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSpendTracker(t *testing.T) {
+	tracker := newSpendTracker(ModelPrice{PromptPerMillion: 0.15, CompletionPerMillion: 0.60}, 0.01)
+
+	usage := TokenUsage{Requests: 1, PromptTokens: 20000, CompletionTokens: 5000}
+	if cost := tracker.costOf(usage); cost != 0.006 {
+		t.Errorf("costOf(%+v) = %v, expected 0.006", usage, cost)
+	}
+
+	tracker.add(usage)
+	if tracker.exhausted() {
+		t.Errorf("expected $0.006 not to exhaust a $0.01 budget")
+	}
+	tracker.add(usage)
+	if !tracker.exhausted() {
+		t.Errorf("expected $0.012 to exhaust a $0.01 budget")
+	}
+
+	unlimited := newSpendTracker(ModelPrice{PromptPerMillion: 100}, 0)
+	unlimited.add(usage)
+	if unlimited.exhausted() {
+		t.Errorf("expected no cap to never be exhausted")
+	}
+}
+
+func TestModelPrice(t *testing.T) {
+	prices := map[string]ModelPrice{"known": {PromptPerMillion: 1}}
+
+	testCases := []struct {
+		model   string
+		maxCost float64
+		ok      bool
+	}{
+		{"known", 0.5, true},
+		{"known", 0, true},
+		{"unknown", 0, true},
+		// a cap that could never trip is an error rather than a silent no-op
+		{"unknown", 0.5, false},
+	}
+
+	for _, tc := range testCases {
+		price, err := modelPrice(prices, tc.model, tc.maxCost)
+		if (err == nil) != tc.ok {
+			t.Errorf("modelPrice(%q, %v) error = %v, expected ok %t", tc.model, tc.maxCost, err, tc.ok)
+		}
+		if err == nil && price != prices[tc.model] {
+			t.Errorf("modelPrice(%q, %v) = %+v, expected %+v", tc.model, tc.maxCost, price, prices[tc.model])
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// when to look beyond the first page for offices
+const (
+	// only when the first page has no offices
+	DiscoverFallback = "fallback"
+	// always, combining offices from every page, for sites that split offices across pages
+	DiscoverAlways = "always"
+	DiscoverOff    = "off"
+)
+
+const DefaultDiscoverPages = 3
+
+// words that suggest a link goes to a page listing offices, and how strongly
+var officeLinkKeywords = map[string]int{
+	"offices":   6,
+	"office":    5,
+	"locations": 6,
+	"location":  5,
+	"district":  3,
+	"contact":   2,
+	"visit":     1,
+	"address":   2,
+}
+
+// words that suggest a link is anything but an office list, even when it mentions one
+var nonOfficeLinkKeywords = []string{"press", "news", "media", "blog", "event", "newsletter", "email", "casework", "grant", "internship", "tour", "flag"}
+
+type candidatePage struct {
+	URL   string
+	Score int
+}
+
+// discoverOfficePages finds the pages on a member's site most likely to list their offices, from
+// the links on the page we have and the site's sitemap. Only pages on the member's own site are
+// considered, best first, up to limit
+func discoverOfficePages(ctx context.Context, pageURL, source string, limit int) []string {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil
+	}
+
+	scores := map[string]int{}
+	consider := func(href, text string) {
+		resolved, ok := resolveSiteURL(base, href)
+		if !ok || normalizePageURL(resolved) == normalizePageURL(pageURL) {
+			return
+		}
+		if score := scoreOfficeLink(resolved, text); score > scores[resolved] {
+			scores[resolved] = score
+		}
+	}
+
+	for _, link := range pageLinks(source) {
+		consider(link.href, link.text)
+	}
+	for _, loc := range sitemapURLs(ctx, base) {
+		consider(loc, "")
+	}
+
+	var candidates []candidatePage
+	for candidateURL, score := range scores {
+		if score > 0 {
+			candidates = append(candidates, candidatePage{URL: candidateURL, Score: score})
+		}
+	}
+	// best score first, then shorter urls since top level pages tend to be the real lists
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Score != candidates[j].Score {
+			return candidates[i].Score > candidates[j].Score
+		}
+		if len(candidates[i].URL) != len(candidates[j].URL) {
+			return len(candidates[i].URL) < len(candidates[j].URL)
+		}
+		return candidates[i].URL < candidates[j].URL
+	})
+
+	var pages []string
+	for i := 0; i < len(candidates) && i < limit; i++ {
+		pages = append(pages, candidates[i].URL)
+	}
+
+	return pages
+}
+
+// resolveSiteURL resolves a possibly relative link against the page it's on, and reports whether
+// it's an http link on the same site
+func resolveSiteURL(base *url.URL, href string) (string, bool) {
+	href = strings.Trim(strings.TrimSpace(href), `"'`)
+	if href == "" || strings.HasPrefix(href, "#") {
+		return "", false
+	}
+
+	ref, err := url.Parse(href)
+	if err != nil {
+		return "", false
+	}
+	resolved := base.ResolveReference(ref)
+	if resolved.Scheme != "http" && resolved.Scheme != "https" {
+		return "", false
+	}
+	if normalizeHost(resolved.String()) != normalizeHost(base.String()) {
+		return "", false
+	}
+	resolved.Fragment = ""
+
+	return resolved.String(), true
+}
+
+func scoreOfficeLink(linkURL, text string) int {
+	parsed, err := url.Parse(linkURL)
+	if err != nil {
+		return 0
+	}
+	haystack := strings.ToLower(parsed.Path + " " + text)
+	for _, keyword := range nonOfficeLinkKeywords {
+		if strings.Contains(haystack, keyword) {
+			return 0
+		}
+	}
+
+	words := strings.FieldsFunc(haystack, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z')
+	})
+	score := 0
+	seen := map[string]bool{}
+	for _, word := range words {
+		if weight, ok := officeLinkKeywords[word]; ok && !seen[word] {
+			score += weight
+			seen[word] = true
+		}
+	}
+
+	return score
+}
+
+type pageLink struct {
+	href string
+	text string
+}
+
+func pageLinks(source string) []pageLink {
+	doc, err := html.Parse(strings.NewReader(source))
+	if err != nil {
+		return nil
+	}
+
+	var links []pageLink
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "a" {
+			if href := attr(n, "href"); href != "" {
+				links = append(links, pageLink{href: href, text: strings.Join(strings.Fields(nodeText(n)), " ")})
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	return links
+}
+
+// pageLinksText lists a page's links one per line as their text and href
+func pageLinksText(source string) string {
+	var sb strings.Builder
+	for _, link := range pageLinks(source) {
+		if strings.HasPrefix(link.href, "#") || strings.HasPrefix(link.href, "javascript:") {
+			continue
+		}
+		fmt.Fprintf(&sb, "%s: %s\n", link.text, link.href)
+	}
+
+	return sb.String()
+}
+
+// sitemaps and sitemap indexes share the loc element
+type sitemapDocument struct {
+	URLs     []string `xml:"url>loc"`
+	Sitemaps []string `xml:"sitemap>loc"`
+}
+
+// how many child sitemaps of a sitemap index we're willing to fetch
+const maxChildSitemaps = 3
+
+// sitemapURLs returns the urls listed in the site's sitemap.xml, following a sitemap index a
+// little way. A missing or broken sitemap just means no urls
+func sitemapURLs(ctx context.Context, base *url.URL) []string {
+	sitemapURL := (&url.URL{Scheme: base.Scheme, Host: base.Host, Path: "/sitemap.xml"}).String()
+
+	var urls []string
+	queue := []string{sitemapURL}
+	for fetched := 0; len(queue) > 0 && fetched <= maxChildSitemaps; fetched++ {
+		current := queue[0]
+		queue = queue[1:]
+
+		source, err := getPageSource(ctx, current)
+		if err != nil {
+			if fetched == 0 {
+				log.Printf("no sitemap for %s: %v", base.Host, err)
+			}
+			continue
+		}
+
+		var doc sitemapDocument
+		err = xml.Unmarshal([]byte(source), &doc)
+		if err != nil {
+			continue
+		}
+		urls = append(urls, doc.URLs...)
+		queue = append(queue, doc.Sitemaps...)
+	}
+
+	return urls
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestResolveSiteURL(t *testing.T) {
+	base, _ := url.Parse("https://pelosi.house.gov/about")
+
+	testCases := []struct {
+		href     string
+		expected string
+		ok       bool
+	}{
+		{"/offices", "https://pelosi.house.gov/offices", true},
+		{"contact/locations#sf", "https://pelosi.house.gov/contact/locations", true},
+		{"https://www.pelosi.house.gov/district", "https://www.pelosi.house.gov/district", true},
+		{"https://schiff.house.gov/offices", "", false},
+		{"mailto:office@pelosi.house.gov", "", false},
+		{"#top", "", false},
+	}
+
+	for _, tc := range testCases {
+		result, ok := resolveSiteURL(base, tc.href)
+		if result != tc.expected || ok != tc.ok {
+			t.Errorf("resolveSiteURL(%q) = %q, %t, expected %q, %t", tc.href, result, ok, tc.expected, tc.ok)
+		}
+	}
+}
+
+func TestScoreOfficeLink(t *testing.T) {
+	testCases := []struct {
+		url      string
+		text     string
+		positive bool
+	}{
+		{"https://pelosi.house.gov/offices", "", true},
+		{"https://pelosi.house.gov/contact", "Office Locations", true},
+		{"https://pelosi.house.gov/about", "District Offices", true},
+		{"https://pelosi.house.gov/media/press-releases", "Office news", false},
+		{"https://pelosi.house.gov/issues", "Issues", false},
+	}
+
+	for _, tc := range testCases {
+		score := scoreOfficeLink(tc.url, tc.text)
+		if (score > 0) != tc.positive {
+			t.Errorf("scoreOfficeLink(%q, %q) = %d, expected positive %t", tc.url, tc.text, score, tc.positive)
+		}
+	}
+
+	if scoreOfficeLink("https://pelosi.house.gov/offices", "") <= scoreOfficeLink("https://pelosi.house.gov/contact", "") {
+		t.Errorf("expected an offices page to outscore a contact page")
+	}
+}
+
+func TestFindAddressesDiscoversOfficePages(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `<html><body><a href="/issues">Issues</a><a href="/district-offices">District Offices</a><a href="https://example.com/offices">Elsewhere</a></body></html>`)
+	})
+	mux.HandleFunc("/sitemap.xml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `<?xml version="1.0"?><urlset><url><loc>%s/contact/dc-office</loc></url><url><loc>%s/news</loc></url></urlset>`, server.URL, server.URL)
+	})
+	mux.HandleFunc("/district-offices", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><body><p>100 Main Street</p><p>Springfield, IL 62701</p><p>(217) 555-0100</p></body></html>`)
+	})
+	mux.HandleFunc("/contact/dc-office", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><body><p>1 Independence Ave SE</p><p>Washington, DC 20515</p><p>(202) 555-0100</p></body></html>`)
+	})
+
+	opts := findOptions{Extractor: ExtractorHeuristic, StructuredData: StructuredOff, Verify: VerifyOff, Discover: DiscoverFallback, DiscoverPages: 3}
+	result, err := findAddresses(context.Background(), server.URL, nil, opts)
+	if err != nil {
+		t.Fatalf("findAddresses() error = %v", err)
+	}
+	if len(result.Offices) != 2 {
+		t.Fatalf("expected offices from both discovered pages, got %+v", result.Offices)
+	}
+	if result.Status != StatusFallbackURL {
+		t.Errorf("expected status %q, got %q", StatusFallbackURL, result.Status)
+	}
+	for _, tried := range result.URLsTried {
+		if tried == "https://example.com/offices" || tried == server.URL+"/news" || tried == server.URL+"/issues" {
+			t.Errorf("expected %s not to be fetched", tried)
+		}
+	}
+}
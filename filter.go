@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// legislatorFilter narrows a scrape down to some legislators, for re-scraping after an election
+// or a bug report. An empty filter matches everyone
+type legislatorFilter struct {
+	States []string
+	// rep or sen
+	Chamber   string
+	Bioguides []string
+	// only legislators with no offices in offices.json
+	OnlyMissing bool
+}
+
+func (f legislatorFilter) active() bool {
+	return len(f.States) > 0 || f.Chamber != "" || len(f.Bioguides) > 0 || f.OnlyMissing
+}
+
+// journalPath is where a run with this filter keeps its journal. Filtered runs each get their own
+// so they can't clobber the progress of an interrupted full run, or of each other
+func (f legislatorFilter) journalPath() string {
+	if !f.active() {
+		return JournalFile
+	}
+
+	var states, bioguides []string
+	for _, state := range f.States {
+		states = append(states, strings.ToUpper(state))
+	}
+	for _, bioguide := range f.Bioguides {
+		bioguides = append(bioguides, strings.ToUpper(bioguide))
+	}
+	sort.Strings(states)
+	sort.Strings(bioguides)
+	key := fmt.Sprintf("%v|%s|%v|%t", states, f.Chamber, bioguides, f.OnlyMissing)
+
+	return strings.TrimSuffix(JournalFile, ".jsonl") + "." + hashString(key)[:12] + ".jsonl"
+}
+
+// apply returns the bioguide to url map for the legislators matching the filter. previous is the
+// current offices.json, used to find who's missing offices
+func (f legislatorFilter) apply(legislators []CurrentLegislator, previous []OfficeList) map[string]string {
+	states := map[string]bool{}
+	for _, state := range f.States {
+		states[strings.ToUpper(state)] = true
+	}
+	bioguides := map[string]bool{}
+	for _, bioguide := range f.Bioguides {
+		bioguides[strings.ToUpper(bioguide)] = true
+	}
+	missing := map[string]bool{}
+	if f.OnlyMissing {
+		for _, bioguide := range legislatorsMissingOffices(legislators, previous) {
+			missing[bioguide] = true
+		}
+	}
+
+	matched := map[string]string{}
+	for _, legislator := range legislators {
+		if len(states) > 0 && !states[strings.ToUpper(legislator.State)] {
+			continue
+		}
+		if f.Chamber != "" && f.Chamber != legislator.Chamber {
+			continue
+		}
+		if len(bioguides) > 0 && !bioguides[strings.ToUpper(legislator.Bioguide)] {
+			continue
+		}
+		if f.OnlyMissing && !missing[legislator.Bioguide] {
+			continue
+		}
+		matched[legislator.Bioguide] = legislator.URL
+	}
+
+	return matched
+}
+
+// legislatorsMissingOffices returns the bioguides of current legislators with no offices in the
+// office list
+func legislatorsMissingOffices(legislators []CurrentLegislator, officeList []OfficeList) []string {
+	existingOffices := map[string]bool{}
+	for _, office := range officeList {
+		if len(office.Offices) > 0 {
+			existingOffices[office.Bioguide] = true
+		}
+	}
+
+	var missing []string
+	for _, legislator := range legislators {
+		if !existingOffices[legislator.Bioguide] {
+			missing = append(missing, legislator.Bioguide)
+		}
+	}
+
+	return missing
+}
+
+// readBioguideFile reads bioguide IDs from a file, one per line, ignoring blank lines and #
+// comments
+func readBioguideFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading bioguide file: %v", err)
+	}
+	defer file.Close()
+
+	var bioguides []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		bioguides = append(bioguides, line)
+	}
+
+	return bioguides, scanner.Err()
+}
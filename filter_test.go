@@ -0,0 +1,45 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestLegislatorFilter(t *testing.T) {
+	legislators := []CurrentLegislator{
+		{Bioguide: "A000001", URL: "https://a.house.gov", State: "CA", Chamber: "rep"},
+		{Bioguide: "B000002", URL: "https://b.senate.gov", State: "CA", Chamber: "sen"},
+		{Bioguide: "C000003", URL: "https://c.house.gov", State: "NY", Chamber: "rep"},
+	}
+	previous := []OfficeList{
+		{Bioguide: "A000001", Offices: []OfficeInfo{{Address: "1 Main St"}}},
+		{Bioguide: "B000002"},
+	}
+
+	tests := []struct {
+		name   string
+		filter legislatorFilter
+		want   []string
+	}{
+		{"No filter", legislatorFilter{}, []string{"A000001", "B000002", "C000003"}},
+		{"State", legislatorFilter{States: []string{"ca"}}, []string{"A000001", "B000002"}},
+		{"Chamber", legislatorFilter{Chamber: "rep"}, []string{"A000001", "C000003"}},
+		{"State and chamber", legislatorFilter{States: []string{"CA"}, Chamber: "sen"}, []string{"B000002"}},
+		{"Bioguides", legislatorFilter{Bioguides: []string{"c000003", "A000001"}}, []string{"A000001", "C000003"}},
+		{"Only missing", legislatorFilter{OnlyMissing: true}, []string{"B000002", "C000003"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for bioguide := range tt.filter.apply(legislators, previous) {
+				got = append(got, bioguide)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("apply() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// how exact an office's coordinates are, best first
+const (
+	// an address point dataset had this exact address
+	GeoPrecisionRooftop = "rooftop"
+	// a map or directions link on the office's page
+	GeoPrecisionMapLink = "map-link"
+	// interpolated along a street's address range
+	GeoPrecisionStreetRange = "street-range"
+	// the middle of the office's zip code
+	GeoPrecisionZipCentroid = "zip-centroid"
+)
+
+var geoPrecisionRank = map[string]int{
+	GeoPrecisionRooftop:     4,
+	GeoPrecisionMapLink:     3,
+	GeoPrecisionStreetRange: 2,
+	GeoPrecisionZipCentroid: 1,
+}
+
+type geoPoint struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// addressRange is one side of a street segment, like the TIGER address range features, with the
+// coordinates of each end
+type addressRange struct {
+	From, To int
+	Start    geoPoint
+	End      geoPoint
+}
+
+// Geocoder places offices using local datasets only, so geocoding never depends on a web service.
+// Any mix of zip centroids, address ranges and address points can be loaded
+type Geocoder struct {
+	zips   map[string]geoPoint
+	ranges map[string][]addressRange
+	points map[string]geoPoint
+}
+
+// the geocoder used by scrape, when it's given geocoding data
+var geocoder *Geocoder
+
+// "100 N Main St" as a house number and street
+var houseNumberRegex = regexp.MustCompile(`^(\d+)[A-Za-z]?(?:-\d+)?\s+(.+)$`)
+
+// loadGeocoder reads geocoding datasets, working out which kind each file is from its header:
+//   - Census ZCTA gazetteer files, or any file with zip, lat and lon columns, for zip centroids
+//   - files with zip, street, from, to, from_lat, from_lon, to_lat and to_lon columns for address
+//     ranges, such as ones exported from TIGER address range features
+//   - files with zip, street, number, lat and lon columns for address points
+//
+// Files can be comma or tab separated
+func loadGeocoder(paths []string) (*Geocoder, error) {
+	geocoder := &Geocoder{
+		zips:   map[string]geoPoint{},
+		ranges: map[string][]addressRange{},
+		points: map[string]geoPoint{},
+	}
+	for _, path := range paths {
+		err := geocoder.load(path)
+		if err != nil {
+			return nil, fmt.Errorf("error loading geocoding data from %s: %v", path, err)
+		}
+	}
+	log.Printf("loaded %d zip centroids, %d streets of address ranges and %d address points for geocoding", len(geocoder.zips), len(geocoder.ranges), len(geocoder.points))
+
+	return geocoder, nil
+}
+
+func (g *Geocoder) load(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+	firstLine := strings.SplitN(string(data), "\n", 2)[0]
+
+	reader := csv.NewReader(strings.NewReader(string(data)))
+	if strings.Contains(firstLine, "\t") {
+		reader.Comma = '\t'
+	}
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return err
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	// the gazetteer's names for the same things
+	for from, to := range map[string]string{"geoid": "zip", "intptlat": "lat", "intptlong": "lon"} {
+		if i, ok := columns[from]; ok {
+			columns[to] = i
+		}
+	}
+	has := func(names ...string) bool {
+		for _, name := range names {
+			if _, ok := columns[name]; !ok {
+				return false
+			}
+		}
+		return true
+	}
+
+	var add func(get func(string) string) error
+	switch {
+	case has("zip", "street", "from", "to", "from_lat", "from_lon", "to_lat", "to_lon"):
+		add = g.addRange
+	case has("zip", "street", "number", "lat", "lon"):
+		add = g.addPoint
+	case has("zip", "lat", "lon"):
+		add = g.addZip
+	default:
+		return fmt.Errorf("unrecognized columns %v", header)
+	}
+
+	line := 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		line++
+		if err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+		get := func(name string) string {
+			if i := columns[name]; i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		err = add(get)
+		if err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+	}
+
+	return nil
+}
+
+func (g *Geocoder) addZip(get func(string) string) error {
+	point, err := parseGeoPoint(get("lat"), get("lon"))
+	if err != nil {
+		return err
+	}
+	g.zips[zipKey(get("zip"))] = point
+	return nil
+}
+
+func (g *Geocoder) addPoint(get func(string) string) error {
+	point, err := parseGeoPoint(get("lat"), get("lon"))
+	if err != nil {
+		return err
+	}
+	g.points[streetKey(get("zip"), get("street"))+"|"+get("number")] = point
+	return nil
+}
+
+func (g *Geocoder) addRange(get func(string) string) error {
+	from, err := strconv.Atoi(get("from"))
+	if err != nil {
+		return err
+	}
+	to, err := strconv.Atoi(get("to"))
+	if err != nil {
+		return err
+	}
+	start, err := parseGeoPoint(get("from_lat"), get("from_lon"))
+	if err != nil {
+		return err
+	}
+	end, err := parseGeoPoint(get("to_lat"), get("to_lon"))
+	if err != nil {
+		return err
+	}
+	key := streetKey(get("zip"), get("street"))
+	g.ranges[key] = append(g.ranges[key], addressRange{From: from, To: to, Start: start, End: end})
+	return nil
+}
+
+func parseGeoPoint(lat, lon string) (geoPoint, error) {
+	latitude, err := strconv.ParseFloat(lat, 64)
+	if err != nil {
+		return geoPoint{}, fmt.Errorf("bad latitude %q", lat)
+	}
+	longitude, err := strconv.ParseFloat(lon, 64)
+	if err != nil {
+		return geoPoint{}, fmt.Errorf("bad longitude %q", lon)
+	}
+	return geoPoint{Latitude: latitude, Longitude: longitude}, nil
+}
+
+func zipKey(zip string) string {
+	zip = strings.TrimSpace(zip)
+	if len(zip) > 5 {
+		zip = zip[:5]
+	}
+	return zip
+}
+
+func streetKey(zip, street string) string {
+	return zipKey(zip) + "|" + normalizeAddress(street)
+}
+
+// Geocode finds the best coordinates the loaded data has for an office
+func (g *Geocoder) Geocode(office OfficeInfo) (geoPoint, string, bool) {
+	if match := houseNumberRegex.FindStringSubmatch(strings.TrimSpace(office.Address)); match != nil {
+		number, street := match[1], streetKey(office.Zip, match[2])
+		if point, ok := g.points[street+"|"+number]; ok {
+			return point, GeoPrecisionRooftop, true
+		}
+
+		house, _ := strconv.Atoi(number)
+		for _, r := range g.ranges[street] {
+			low, high := r.From, r.To
+			if low > high {
+				low, high = high, low
+			}
+			if house < low || house > high {
+				continue
+			}
+			fraction := 0.5
+			if r.To != r.From {
+				fraction = float64(house-r.From) / float64(r.To-r.From)
+			}
+			return geoPoint{
+				Latitude:  r.Start.Latitude + fraction*(r.End.Latitude-r.Start.Latitude),
+				Longitude: r.Start.Longitude + fraction*(r.End.Longitude-r.Start.Longitude),
+			}, GeoPrecisionStreetRange, true
+		}
+	}
+
+	if point, ok := g.zips[zipKey(office.Zip)]; ok {
+		return point, GeoPrecisionZipCentroid, true
+	}
+
+	return geoPoint{}, "", false
+}
+
+// geoPrecision is how exact an office's coordinates are
+func geoPrecision(office OfficeInfo) string {
+	// coordinates from before precision was recorded came from map links
+	if office.GeoPrecision == "" && office.Latitude != 0 {
+		return GeoPrecisionMapLink
+	}
+	return office.GeoPrecision
+}
+
+// pinpointed reports whether an office's coordinates are exact enough to publish. Street ranges
+// and zip centroids are only estimates, good for a map of the district but not for directions
+func pinpointed(office OfficeInfo) bool {
+	precision := geoPrecision(office)
+	return precision == GeoPrecisionRooftop || precision == GeoPrecisionMapLink
+}
+
+// geocodeOffices fills in coordinates for offices that don't have any, or improves on ones that
+// are less precise than what the data has. It returns how many offices it placed
+func (g *Geocoder) geocodeOffices(offices []OfficeInfo) int {
+	placed := 0
+	for i := range offices {
+		point, precision, ok := g.Geocode(offices[i])
+		if !ok {
+			continue
+		}
+		current := geoPrecision(offices[i])
+		if geoPrecisionRank[current] >= geoPrecisionRank[precision] {
+			continue
+		}
+		offices[i].Latitude, offices[i].Longitude = point.Latitude, point.Longitude
+		offices[i].GeoPrecision = precision
+		placed++
+	}
+
+	return placed
+}
+
+func (g *Geocoder) geocodeOfficeLists(officeList []OfficeList) int {
+	placed := 0
+	for _, leg := range officeList {
+		placed += g.geocodeOffices(leg.Offices)
+	}
+
+	return placed
+}
+
+// geocodeOfficesFile geocodes every office in offices.json in place
+func geocodeOfficesFile(dataPaths []string) error {
+	if len(dataPaths) == 0 {
+		return fmt.Errorf("no geocoding data given")
+	}
+	geocoder, err := loadGeocoder(dataPaths)
+	if err != nil {
+		return err
+	}
+
+	officeList, err := readOfficeList(OfficesFile)
+	if err != nil {
+		return err
+	}
+
+	placed := geocoder.geocodeOfficeLists(officeList)
+
+	counts := map[string]int{}
+	total := 0
+	for _, leg := range officeList {
+		for _, office := range leg.Offices {
+			counts[geoPrecision(office)]++
+			total++
+		}
+	}
+	log.Printf("geocoded %d offices. Of %d offices, %d rooftop, %d map link, %d street range, %d zip centroid and %d without coordinates", placed, total,
+		counts[GeoPrecisionRooftop], counts[GeoPrecisionMapLink], counts[GeoPrecisionStreetRange], counts[GeoPrecisionZipCentroid], counts[""])
+
+	return writeOfficeList(OfficesFile, officeList)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGeocoder(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"zcta.txt": "GEOID\tALAND\tAWATER\tALAND_SQMI\tAWATER_SQMI\tINTPTLAT\tINTPTLONG    \n" +
+			"62701\t4584458\t0\t1.77\t0\t39.800\t-89.650\n" +
+			"61602\t3004000\t0\t1.16\t0\t40.690\t-89.590\n" +
+			"62523\t3004000\t0\t1.16\t0\t39.840\t-88.950\n",
+		"ranges.csv": "zip,street,from,to,from_lat,from_lon,to_lat,to_lon\n" +
+			"62701,Main Street,100,198,39.8000,-89.6400,39.8010,-89.6400\n",
+		"points.csv": "zip,street,number,lat,lon\n" +
+			"61602,Elm St,200,40.6936,-89.5890\n",
+	}
+	var paths []string
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		err := os.WriteFile(path, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	geocoder, err := loadGeocoder(paths)
+	if err != nil {
+		t.Fatalf("loadGeocoder() error = %v", err)
+	}
+
+	offices := []OfficeInfo{
+		{Address: "149 Main St", City: "Springfield", State: "IL", Zip: "62701"},
+		{Address: "200 Elm Street", City: "Peoria", State: "IL", Zip: "61602"},
+		{Address: "300 Oak Street", City: "Decatur", State: "IL", Zip: "62523-1234"},
+		// coordinates from a map link beat a zip centroid
+		{Address: "1 Park Place", City: "Springfield", State: "IL", Zip: "62701", Latitude: 39.81, Longitude: -89.66, GeoPrecision: GeoPrecisionMapLink},
+		{Address: "1 Nowhere Rd", City: "Nowhere", State: "IL", Zip: "99999"},
+	}
+	placed := geocoder.geocodeOffices(offices)
+	if placed != 3 {
+		t.Errorf("expected 3 offices placed, got %d", placed)
+	}
+
+	expected := []struct {
+		latitude, longitude float64
+		precision           string
+	}{
+		{39.8005, -89.64, GeoPrecisionStreetRange},
+		{40.6936, -89.5890, GeoPrecisionRooftop},
+		{39.84, -88.95, GeoPrecisionZipCentroid},
+		{39.81, -89.66, GeoPrecisionMapLink},
+		{0, 0, ""},
+	}
+	for i, office := range offices {
+		if math.Abs(office.Latitude-expected[i].latitude) > 1e-6 || math.Abs(office.Longitude-expected[i].longitude) > 1e-6 || office.GeoPrecision != expected[i].precision {
+			t.Errorf("office at %s got %v,%v %q, expected %v,%v %q", office.Address, office.Latitude, office.Longitude, office.GeoPrecision,
+				expected[i].latitude, expected[i].longitude, expected[i].precision)
+		}
+	}
+
+	_, err = loadGeocoder([]string{filepath.Join(dir, "missing.csv")})
+	if err == nil {
+		t.Errorf("expected an error for a missing data file")
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// ways of extracting offices from page text
+const (
+	// ask the llm, falling back to the heuristic extractor if the llm call fails in a way that
+	// might go better next time, see canFallBackToHeuristics
+	ExtractorLLM = "llm"
+	// only use the heuristic extractor, no llm calls at all
+	ExtractorHeuristic = "heuristic"
+	// ask the llm and log where the heuristic extractor disagrees with it
+	ExtractorCheck = "check"
+)
+
+var stateAbbreviations = map[string]bool{
+	"AL": true, "AK": true, "AZ": true, "AR": true, "CA": true, "CO": true, "CT": true, "DE": true,
+	"FL": true, "GA": true, "HI": true, "ID": true, "IL": true, "IN": true, "IA": true, "KS": true,
+	"KY": true, "LA": true, "ME": true, "MD": true, "MA": true, "MI": true, "MN": true, "MS": true,
+	"MO": true, "MT": true, "NE": true, "NV": true, "NH": true, "NJ": true, "NM": true, "NY": true,
+	"NC": true, "ND": true, "OH": true, "OK": true, "OR": true, "PA": true, "RI": true, "SC": true,
+	"SD": true, "TN": true, "TX": true, "UT": true, "VT": true, "VA": true, "WA": true, "WV": true,
+	"WI": true, "WY": true, "DC": true, "PR": true, "GU": true, "VI": true, "AS": true, "MP": true,
+}
+
+var (
+	// "Springfield, IL 62701" possibly at the end of a line with the street before it
+	cityStateZipRegex = regexp.MustCompile(`([A-Za-z][A-Za-z .'-]*?),?\s+([A-Za-z]\.?[A-Za-z])\.?\s+(\d{5})(?:-\d{4})?\s*$`)
+	streetLineRegex   = regexp.MustCompile(`(?i)^(\d+[A-Za-z]?(?:-\d+)?\s+\S.*|p\.?\s*o\.?\s*box\s+\d+.*)$`)
+	suiteLineRegex    = regexp.MustCompile(`(?i)^(suite|ste\.?|room|rm\.?|unit|#)\s*[\w\.-]+$`)
+	phoneRegex        = regexp.MustCompile(`\(?\b\d{3}\)?[\s.-]*\d{3}[\s.-]*\d{4}\b`)
+	faxLabelRegex     = regexp.MustCompile(`(?i)\bfax\b|\bf:`)
+)
+
+// extractHeuristicOffices finds offices in page text without a model, by looking for
+// "City, ST 12345" lines and the street, suite and phone lines around them. Each office gets a
+// confidence score based on how many of the expected pieces were found
+func extractHeuristicOffices(text string) []OfficeInfo {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	var offices []OfficeInfo
+	for i, line := range lines {
+		match := cityStateZipRegex.FindStringSubmatchIndex(line)
+		if match == nil {
+			continue
+		}
+		state := formatState(line[match[4]:match[5]])
+		if !stateAbbreviations[state] {
+			continue
+		}
+
+		office := OfficeInfo{
+			City:  strings.TrimSpace(line[match[2]:match[3]]),
+			State: state,
+			Zip:   line[match[6]:match[7]],
+		}
+
+		// the street may share the line with the city, separated by commas
+		prefix := strings.TrimRight(strings.TrimSpace(line[:match[2]]), ",")
+		if prefix != "" {
+			parts := strings.Split(prefix, ",")
+			var street []string
+			for _, part := range parts {
+				part = strings.TrimSpace(part)
+				if suiteLineRegex.MatchString(part) {
+					office.Suite = part
+				} else if part != "" {
+					street = append(street, part)
+				}
+			}
+			// with no comma between street and city we can't tell where one ends
+			if len(street) > 0 && streetLineRegex.MatchString(street[0]) {
+				office.Address = strings.Join(street, ", ")
+			}
+		}
+
+		// otherwise look back a few lines for the street, suite and building
+		for j := i - 1; j >= 0 && j >= i-3 && office.Address == ""; j-- {
+			prev := lines[j]
+			if cityStateZipRegex.MatchString(prev) || phoneRegex.MatchString(prev) {
+				break
+			}
+			if suiteLineRegex.MatchString(prev) {
+				office.Suite = prev
+				continue
+			}
+			if streetLineRegex.MatchString(prev) {
+				office.Address, office.Suite = splitStreetLine(prev, office.Suite)
+				if j > 0 && strings.Contains(strings.ToLower(lines[j-1]), "building") && !phoneRegex.MatchString(lines[j-1]) {
+					office.Building = lines[j-1]
+				}
+			}
+		}
+		if office.Address == "" {
+			continue
+		}
+
+		// phone and fax usually follow the city line
+		for j := i + 1; j < len(lines) && j <= i+4; j++ {
+			next := lines[j]
+			phone := phoneRegex.FindString(next)
+			if phone == "" {
+				if cityStateZipRegex.MatchString(next) || streetLineRegex.MatchString(next) {
+					break
+				}
+				continue
+			}
+			if faxLabelRegex.MatchString(next) {
+				if office.Fax == "" {
+					office.Fax = phone
+				}
+			} else if office.Phone == "" {
+				office.Phone = phone
+			}
+		}
+
+		office.Confidence = heuristicConfidence(office)
+		offices = append(offices, office)
+	}
+
+	return dedupeOffices(offices)
+}
+
+// canFallBackToHeuristics reports whether an llm failure should be covered up with heuristic
+// offices. That's only for failures that say nothing about whether the run should carry on:
+//   - 429s and 5xx responses that were still failing after retries
+//   - network errors reaching the model
+//   - responses that weren't the json we asked for
+//
+// Anything else, like a cancelled or timed out run, the spending cap or a bad api key, is returned
+// as an error so regex quality offices don't replace good ones as if the scrape had worked
+func canFallBackToHeuristics(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || spending.exhausted() {
+		return false
+	}
+
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.HTTPStatusCode == http.StatusTooManyRequests || apiErr.HTTPStatusCode >= 500
+	}
+	var requestErr *openai.RequestError
+	if errors.As(err, &requestErr) {
+		return requestErr.HTTPStatusCode == http.StatusTooManyRequests || requestErr.HTTPStatusCode >= 500
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	return errors.As(err, &syntaxErr) || errors.As(err, &typeErr)
+}
+
+// fromHeuristics reports whether any of the offices came from the heuristic extractor, which is
+// the only one that scores its offices
+func fromHeuristics(offices []OfficeInfo) bool {
+	for _, office := range offices {
+		if office.Confidence > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// splitStreetLine pulls a suite off the end of a street line unless we already found one
+func splitStreetLine(line, suite string) (string, string) {
+	street, lineSuite := splitSuite(line)
+	if lineSuite != "" && suite == "" {
+		suite = lineSuite
+	}
+
+	return strings.TrimRight(street, ","), suite
+}
+
+func heuristicConfidence(office OfficeInfo) float64 {
+	// city, state and zip matched, and there's a street line
+	confidence := 0.5
+
+	words := strings.Fields(normalizeAddress(office.Address))
+	for _, word := range words {
+		if isStreetTypeAbbreviation(word) {
+			confidence += 0.2
+			break
+		}
+	}
+	if office.Phone != "" {
+		confidence += 0.2
+	}
+	if office.Suite != "" || office.Building != "" {
+		confidence += 0.1
+	}
+
+	// round so the scores stay readable in offices.json
+	return math.Min(1, math.Round(confidence*100)/100)
+}
+
+func isStreetTypeAbbreviation(word string) bool {
+	for _, abbr := range streetTypeAbbreviations {
+		if word == abbr {
+			return true
+		}
+	}
+
+	return false
+}
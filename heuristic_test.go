@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestExtractHeuristicOffices(t *testing.T) {
+	text := `Home
+Contact
+
+Washington, DC Office
+2000 Rayburn House Office Building
+Washington, DC 20515
+Phone: (202) 225-0000
+Fax: (202) 225-0001
+
+Springfield Office
+Federal Building
+100 Main Street, Suite 200
+Springfield, IL 62701
+Phone: 217-555-0100
+
+Peoria Office
+5 Elm Ave, Room 3, Peoria, IL 61602-1234
+
+Sign up for our newsletter`
+
+	want := []OfficeInfo{
+		{Address: "2000 Rayburn House Office Building", City: "Washington", State: "DC", Zip: "20515", Phone: "(202) 225-0000", Fax: "(202) 225-0001", Confidence: 0.7},
+		{Address: "100 Main Street", Suite: "Suite 200", Building: "Federal Building", City: "Springfield", State: "IL", Zip: "62701", Phone: "217-555-0100", Confidence: 1},
+		{Address: "5 Elm Ave", Suite: "Room 3", City: "Peoria", State: "IL", Zip: "61602", Confidence: 0.8},
+	}
+
+	got := extractHeuristicOffices(text)
+	if len(got) != len(want) {
+		t.Fatalf("extractHeuristicOffices() = %+v, want %d offices", got, len(want))
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("extractHeuristicOffices()[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestSplitSuite(t *testing.T) {
+	testCases := []struct {
+		input  string
+		street string
+		suite  string
+	}{
+		{"100 Main Street, Suite 200", "100 Main Street", "Suite 200"},
+		{"100 Main Street Ste. 4B", "100 Main Street", "Ste. 4B"},
+		{"100 Main Street #12", "100 Main Street", "#12"},
+		{"100 Main Street", "100 Main Street", ""},
+	}
+
+	for _, tc := range testCases {
+		street, suite := splitSuite(tc.input)
+		if street != tc.street || suite != tc.suite {
+			t.Errorf("splitSuite(%q) = %q, %q, expected %q, %q", tc.input, street, suite, tc.street, tc.suite)
+		}
+	}
+}
+
+func TestHeuristicFallback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><body><p>100 Main Street</p><p>Springfield, IL 62701</p><p>Phone: 217-555-0100</p></body></html>`)
+	}))
+	defer server.Close()
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	testCases := []struct {
+		name     string
+		ctx      context.Context
+		err      error
+		fallBack bool
+	}{
+		{"overloaded", context.Background(), &openai.APIError{HTTPStatusCode: 503}, true},
+		{"rate limited", context.Background(), &openai.RequestError{HTTPStatusCode: 429, Err: errors.New("slow down")}, true},
+		{"network", context.Background(), &net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{"bad json", context.Background(), &json.SyntaxError{}, true},
+		{"bad key", context.Background(), &openai.APIError{HTTPStatusCode: 401}, false},
+		{"llm timeout", context.Background(), fmt.Errorf("completion: %w", context.DeadlineExceeded), false},
+		{"cancelled run", cancelled, &openai.APIError{HTTPStatusCode: 503}, false},
+	}
+
+	for _, tc := range testCases {
+		llmProvider = &FakeProvider{Err: tc.err}
+		result, err := findAddresses(tc.ctx, server.URL, nil, findOptions{Discover: DiscoverOff})
+		if tc.fallBack {
+			if err != nil || len(result.Offices) != 1 || result.Offices[0].Confidence == 0 {
+				t.Errorf("%s: expected heuristic offices, got %+v, %v", tc.name, result.Offices, err)
+			}
+			if result.ContentHash != "" {
+				t.Errorf("%s: expected heuristic offices not to get a content hash", tc.name)
+			}
+		} else if err == nil {
+			t.Errorf("%s: expected the llm error, got %+v", tc.name, result.Offices)
+		}
+	}
+}
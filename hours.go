@@ -0,0 +1,358 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// how days are written in normalized hours, monday first
+var hoursDayNames = []string{"M", "Tu", "W", "Th", "F", "Sa", "Su"}
+
+var hoursDayIndex = map[string]int{
+	"monday": 0, "mon": 0,
+	"tuesday": 1, "tues": 1, "tue": 1,
+	"wednesday": 2, "wed": 2,
+	"thursday": 3, "thurs": 3, "thur": 3, "thu": 3,
+	"friday": 4, "fri": 4,
+	"saturday": 5, "sat": 5,
+	"sunday": 6, "sun": 6,
+}
+
+const hoursDayPattern = `monday|mon|tuesday|tues|tue|wednesday|wed|thursday|thurs|thur|thu|friday|fri|saturday|sat|sunday|sun`
+
+var (
+	// "Monday", "Tuesdays", "Mon. - Fri.", "Monday through Thursday", the common "M-F", "weekdays" and "weekends"
+	hoursDaysRegex = regexp.MustCompile(`(?i)\b(` + hoursDayPattern + `)s?\b\.?(?:\s*(?:-|–|—|to|through|thru)\s*(` + hoursDayPattern + `)s?\b\.?)?|\b(m)\s*[-–]\s*(f)\b|\b(weekdays?)\b|\b(weekends?)\b`)
+	// "9:00 a.m. - 5:00 p.m.", "9-5", "09:00-17:00", "8:30am to noon"
+	hoursTimeRegex = regexp.MustCompile(`(?i)\b(\d{1,2}(?::\d{2})?|noon)\s*(a\.?m\.?|p\.?m\.?)?\s*(?:-|–|—|to|until)\s*(\d{1,2}(?::\d{2})?|noon)\s*(a\.?m\.?|p\.?m\.?)?`)
+	// schema.org's two letter days, only used where we know we're reading openingHours
+	schemaDayRegex   = regexp.MustCompile(`\b(Mo|Tu|We|Th|Fr|Sa|Su)\b`)
+	appointmentRegex = regexp.MustCompile(`(?i)\bby appointment\b`)
+	closedRegex      = regexp.MustCompile(`(?i)\bclosed\b`)
+)
+
+var schemaDays = map[string]string{"Mo": "Mon", "Tu": "Tue", "We": "Wed", "Th": "Thu", "Fr": "Fri", "Sa": "Sat", "Su": "Sun"}
+
+// hoursRange is an opening time and closing time in minutes after midnight
+type hoursRange struct {
+	Open  int
+	Close int
+}
+
+// hoursSegment is a set of days sharing the same opening hours
+type hoursSegment struct {
+	// indexes into hoursDayNames, empty when the hours didn't say which days
+	Days   []int
+	Ranges []hoursRange
+}
+
+// normalizeHours rewrites opening hours in the consistent form used upstream, like
+// "M-F 9AM-5PM" or "M-Th 9AM-5PM; F 9AM-3PM". Hours we can't make sense of are returned with
+// their whitespace tidied but otherwise as they were
+func normalizeHours(hours string) string {
+	hours = strings.Join(strings.Fields(hours), " ")
+	segments := parseHoursSegments(hours)
+	if len(segments) == 0 {
+		return hours
+	}
+
+	formatted := formatHoursSegments(segments)
+	if appointmentRegex.MatchString(hours) {
+		formatted += "; by appointment"
+	}
+
+	return formatted
+}
+
+// schemaOpeningHours turns schema.org openingHours values like "Mo-Fr 09:00-17:00" into text the
+// hours parser understands
+func schemaOpeningHours(values []string) string {
+	var parts []string
+	for _, value := range values {
+		parts = append(parts, schemaDayRegex.ReplaceAllStringFunc(value, func(day string) string {
+			return schemaDays[day]
+		}))
+	}
+
+	return strings.Join(parts, "; ")
+}
+
+type hoursToken struct {
+	position int
+	days     []int
+	time     *hoursRange
+	closed   bool
+}
+
+func parseHoursSegments(hours string) []hoursSegment {
+	var tokens []hoursToken
+	for _, match := range hoursTimeRegex.FindAllStringSubmatchIndex(hours, -1) {
+		group := func(i int) string {
+			if match[2*i] < 0 {
+				return ""
+			}
+			return hours[match[2*i]:match[2*i+1]]
+		}
+		if r, ok := parseHoursRange(group(1), group(2), group(3), group(4)); ok {
+			tokens = append(tokens, hoursToken{position: match[0], time: &r})
+		}
+	}
+	for _, match := range hoursDaysRegex.FindAllStringSubmatchIndex(hours, -1) {
+		var first, last string
+		switch {
+		case match[6] >= 0, match[10] >= 0:
+			first, last = "monday", "friday"
+		case match[12] >= 0:
+			first, last = "saturday", "sunday"
+		default:
+			first = strings.ToLower(hours[match[2]:match[3]])
+			last = first
+			if match[4] >= 0 {
+				last = strings.ToLower(hours[match[4]:match[5]])
+			}
+		}
+		tokens = append(tokens, hoursToken{position: match[0], days: hoursDayRange(hoursDayIndex[first], hoursDayIndex[last])})
+	}
+	for _, match := range closedRegex.FindAllStringIndex(hours, -1) {
+		tokens = append(tokens, hoursToken{position: match[0], closed: true})
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].position < tokens[j].position
+	})
+
+	var segments []hoursSegment
+	var pendingDays []int
+	lastWasTime := false
+	afterClosed := false
+	daysTrail := false
+	for _, token := range tokens {
+		// days that are closed don't get the next hours
+		if token.closed {
+			pendingDays = nil
+			lastWasTime = false
+			afterClosed = true
+			continue
+		}
+		if token.time == nil {
+			// days written after their hours, like "9-5 M-F" or "9am-5pm (Mon-Fri)"
+			if lastWasTime && len(segments[len(segments)-1].Days) == 0 {
+				segments[len(segments)-1].Days = uniqueDays(token.days)
+				daysTrail = true
+				lastWasTime = false
+				continue
+			}
+			if lastWasTime {
+				pendingDays = nil
+			}
+			pendingDays = append(pendingDays, token.days...)
+			lastWasTime = false
+			afterClosed = false
+			continue
+		}
+
+		// hours right after "closed", like "closed 12-1 for lunch", are taken out of the days before
+		if afterClosed {
+			if len(segments) > 0 {
+				last := &segments[len(segments)-1]
+				last.Ranges = subtractHoursRange(last.Ranges, *token.time)
+			}
+			afterClosed = false
+			continue
+		}
+
+		// a second time with no days in between, like a lunch break, belongs to the same days. Once
+		// days have come after their hours though, hours with no days before them start a new segment
+		if lastWasTime || (len(pendingDays) == 0 && len(segments) > 0 && !daysTrail) {
+			segments[len(segments)-1].Ranges = append(segments[len(segments)-1].Ranges, *token.time)
+		} else {
+			segments = append(segments, hoursSegment{Days: uniqueDays(pendingDays), Ranges: []hoursRange{*token.time}})
+		}
+		pendingDays = nil
+		lastWasTime = true
+	}
+
+	return segments
+}
+
+// subtractHoursRange takes a closed period out of opening hours, splitting any range it falls inside
+func subtractHoursRange(ranges []hoursRange, closed hoursRange) []hoursRange {
+	var remaining []hoursRange
+	for _, r := range ranges {
+		if closed.Close <= r.Open || closed.Open >= r.Close {
+			remaining = append(remaining, r)
+			continue
+		}
+		if closed.Open > r.Open {
+			remaining = append(remaining, hoursRange{Open: r.Open, Close: closed.Open})
+		}
+		if closed.Close < r.Close {
+			remaining = append(remaining, hoursRange{Open: closed.Close, Close: r.Close})
+		}
+	}
+
+	return remaining
+}
+
+// hoursDayRange lists the days from first to last, wrapping around the week for "Sat-Mon"
+func hoursDayRange(first, last int) []int {
+	var days []int
+	for day := first; ; day = (day + 1) % 7 {
+		days = append(days, day)
+		if day == last {
+			break
+		}
+	}
+	return days
+}
+
+func uniqueDays(days []int) []int {
+	seen := map[int]bool{}
+	var unique []int
+	for _, day := range days {
+		if !seen[day] {
+			seen[day] = true
+			unique = append(unique, day)
+		}
+	}
+	sort.Ints(unique)
+	return unique
+}
+
+// parseHoursRange works out the times of "9-5", "9:00 AM - 5:30 PM" or "13:00-17:00", guessing
+// at am and pm the way people mean them when they're left out
+func parseHoursRange(open, openMeridiem, close, closeMeridiem string) (hoursRange, bool) {
+	openHour, openMinute, ok := parseClock(open)
+	if !ok {
+		return hoursRange{}, false
+	}
+	closeHour, closeMinute, ok := parseClock(close)
+	if !ok {
+		return hoursRange{}, false
+	}
+	openMeridiem = meridiem(openMeridiem)
+	closeMeridiem = meridiem(closeMeridiem)
+	if strings.EqualFold(open, "noon") {
+		openMeridiem = "pm"
+	}
+	if strings.EqualFold(close, "noon") {
+		closeMeridiem = "pm"
+	}
+
+	if openMeridiem == "" && openHour <= 12 {
+		switch {
+		case closeMeridiem == "pm" && openHour < closeHour && closeHour != 12 && openHour < 8:
+			// "1-5pm"
+			openMeridiem = "pm"
+		case openHour == 12 || openHour < 6:
+			openMeridiem = "pm"
+		default:
+			openMeridiem = "am"
+		}
+	}
+	openMinutes := clockMinutes(openHour, openMinute, openMeridiem)
+
+	closeMinutes := clockMinutes(closeHour, closeMinute, closeMeridiem)
+	if closeMeridiem == "" && closeHour <= 12 && closeMinutes <= openMinutes {
+		closeMinutes += 12 * 60
+	}
+
+	return hoursRange{Open: openMinutes, Close: closeMinutes}, true
+}
+
+func parseClock(clock string) (int, int, bool) {
+	if strings.EqualFold(clock, "noon") {
+		return 12, 0, true
+	}
+	parts := strings.SplitN(clock, ":", 2)
+	hour, err := strconv.Atoi(parts[0])
+	if err != nil || hour > 24 {
+		return 0, 0, false
+	}
+	minute := 0
+	if len(parts) == 2 {
+		minute, err = strconv.Atoi(parts[1])
+		if err != nil || minute > 59 {
+			return 0, 0, false
+		}
+	}
+	return hour, minute, true
+}
+
+func meridiem(text string) string {
+	text = strings.ToLower(strings.ReplaceAll(text, ".", ""))
+	if text == "am" || text == "pm" {
+		return text
+	}
+	return ""
+}
+
+// clockMinutes converts a 12 or 24 hour clock time to minutes after midnight
+func clockMinutes(hour, minute int, period string) int {
+	switch {
+	case period == "am" && hour == 12:
+		hour = 0
+	case period == "pm" && hour < 12:
+		hour += 12
+	}
+	return hour*60 + minute
+}
+
+func formatHoursSegments(segments []hoursSegment) string {
+	var parts []string
+	for _, segment := range segments {
+		var ranges []string
+		for _, r := range segment.Ranges {
+			ranges = append(ranges, formatClock(r.Open)+"-"+formatClock(r.Close))
+		}
+		part := strings.Join(ranges, ", ")
+		if days := formatDays(segment.Days); days != "" {
+			part = days + " " + part
+		}
+		parts = append(parts, part)
+	}
+
+	return strings.Join(parts, "; ")
+}
+
+// formatDays writes runs of consecutive days as ranges, like "M-W, F"
+func formatDays(days []int) string {
+	var runs []string
+	for i := 0; i < len(days); {
+		j := i
+		for j+1 < len(days) && days[j+1] == days[j]+1 {
+			j++
+		}
+		switch {
+		case j == i:
+			runs = append(runs, hoursDayNames[days[i]])
+		case j == i+1:
+			runs = append(runs, hoursDayNames[days[i]], hoursDayNames[days[j]])
+		default:
+			runs = append(runs, hoursDayNames[days[i]]+"-"+hoursDayNames[days[j]])
+		}
+		i = j + 1
+	}
+
+	return strings.Join(runs, ", ")
+}
+
+// formatClock writes minutes after midnight like "9AM" or "5:30PM"
+func formatClock(minutes int) string {
+	minutes %= 24 * 60
+	hour, minute := minutes/60, minutes%60
+	suffix := "AM"
+	if hour >= 12 {
+		suffix = "PM"
+	}
+	hour %= 12
+	if hour == 0 {
+		hour = 12
+	}
+	if minute == 0 {
+		return fmt.Sprintf("%d%s", hour, suffix)
+	}
+	return fmt.Sprintf("%d:%02d%s", hour, minute, suffix)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestNormalizeHours(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"Monday - Friday: 9:00 a.m. - 5:00 p.m.", "M-F 9AM-5PM"},
+		{"Mon-Fri 9am to 5:30pm", "M-F 9AM-5:30PM"},
+		{"Monday through Friday, 8:30 AM to 5:00 PM", "M-F 8:30AM-5PM"},
+		{"M-F 9-5", "M-F 9AM-5PM"},
+		{"Mon-Thu 9-5; Fri 9-3", "M-Th 9AM-5PM; F 9AM-3PM"},
+		{"Monday-Friday 9am-12pm, 1pm-5pm", "M-F 9AM-12PM, 1PM-5PM"},
+		{"Monday, Wednesday and Friday\n10 AM – 2 PM", "M, W, F 10AM-2PM"},
+		{"Monday-Friday 9-5, Saturday: Closed, Sunday 12-4", "M-F 9AM-5PM; Su 12PM-4PM"},
+		{"Tuesdays 8:30am to noon", "Tu 8:30AM-12PM"},
+		{"Mon-Fri 8:30am-4:30pm, closed 12-1 for lunch", "M-F 8:30AM-12PM, 1PM-4:30PM"},
+		{"Weekdays 9am-5pm", "M-F 9AM-5PM"},
+		{"9:00 a.m. to 5:00 p.m., Monday through Friday", "M-F 9AM-5PM"},
+		{"Hours: 9-5 M-F", "M-F 9AM-5PM"},
+		{"9am-5pm (Mon-Fri)", "M-F 9AM-5PM"},
+		{"9am-12pm, 1pm-5pm Monday-Friday", "M-F 9AM-12PM, 1PM-5PM"},
+		{"9-5 Monday-Thursday, 9-3 Friday", "M-Th 9AM-5PM; F 9AM-3PM"},
+		{"Weekdays 9-5, weekends 10-2", "M-F 9AM-5PM; Sa, Su 10AM-2PM"},
+		{"9:00 AM - 5:00 PM", "9AM-5PM"},
+		{"Mon-Fri 09:00-17:00", "M-F 9AM-5PM"},
+		{"Monday-Friday 9-5, Saturday by appointment", "M-F 9AM-5PM; by appointment"},
+		{"By appointment   only", "By appointment only"},
+		{"", ""},
+	}
+
+	for _, tc := range testCases {
+		result := normalizeHours(tc.input)
+		if result != tc.expected {
+			t.Errorf("normalizeHours(%q) = %q, expected %q", tc.input, result, tc.expected)
+		}
+	}
+}
+
+func TestStructuredOpeningHours(t *testing.T) {
+	page := `<html><head><script type="application/ld+json">{"@type":"GovernmentOffice","telephone":"(217) 555-0100","openingHours":["Mo-Th 09:00-17:00","Fr 09:00-15:00"],
+"address":{"@type":"PostalAddress","streetAddress":"100 Main Street","addressLocality":"Springfield","addressRegion":"IL","postalCode":"62701"}}</script></head><body></body></html>`
+
+	offices := extractStructuredOffices(page)
+	if len(offices) != 1 {
+		t.Fatalf("expected 1 office, got %+v", offices)
+	}
+	if hours := normalizeHours(offices[0].Hours); hours != "M-Th 9AM-5PM; F 9AM-3PM" {
+		t.Errorf("expected structured hours, got %q from %q", hours, offices[0].Hours)
+	}
+}
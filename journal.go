@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+)
+
+const JournalFile = "scrape.journal.jsonl"
+
+// scrapeJournal appends each legislator's results to a jsonl file as soon as they're done, so an
+// interrupted or crashed run can be resumed without fetching and extracting them again
+type scrapeJournal struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// openJournal starts a journal for a run. When resuming, the entries already in the journal are
+// returned and new ones are appended. Otherwise an old journal is only thrown away with force,
+// since it's the only record of an interrupted run's progress
+func openJournal(path string, resume, force bool) (*scrapeJournal, []OfficeList, error) {
+	var completed []OfficeList
+	if resume {
+		var err error
+		completed, err = readJournal(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, nil, err
+		}
+		err = trimPartialLine(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, nil, fmt.Errorf("error repairing journal: %v", err)
+		}
+	} else if info, err := os.Stat(path); err == nil && info.Size() > 0 && !force {
+		return nil, nil, fmt.Errorf("%s has the progress of an interrupted run, use -resume to continue it or -force to start over", path)
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if !resume {
+		flags |= os.O_TRUNC
+	}
+	file, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening journal: %v", err)
+	}
+
+	return &scrapeJournal{file: file}, completed, nil
+}
+
+func readJournal(path string) ([]OfficeList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var completed []OfficeList
+	scanner := bufio.NewScanner(file)
+	// pages with lots of offices make for long lines
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var leg OfficeList
+		err := json.Unmarshal(scanner.Bytes(), &leg)
+		if err != nil {
+			// most likely the last line was cut off by a crash, that legislator will be redone
+			log.Printf("skipping unreadable journal line: %v", err)
+			continue
+		}
+		completed = append(completed, leg)
+	}
+
+	return completed, scanner.Err()
+}
+
+// trimPartialLine cuts off a last line left unfinished by a crash, so the next entry starts on a
+// line of its own instead of being appended to the broken one
+func trimPartialLine(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	end := bytes.LastIndexByte(data, '\n') + 1
+	if end == len(data) {
+		return nil
+	}
+	log.Printf("removing %d bytes of unfinished entry from the end of %s", len(data)-end, path)
+
+	return os.Truncate(path, int64(end))
+}
+
+// Record appends one legislator's results, synced to disk so it survives a crash
+func (j *scrapeJournal) Record(leg OfficeList) error {
+	if j == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(leg)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	_, err = j.file.Write(append(data, '\n'))
+	if err != nil {
+		return err
+	}
+
+	return j.file.Sync()
+}
+
+func (j *scrapeJournal) Close() error {
+	if j == nil {
+		return nil
+	}
+
+	return j.file.Close()
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJournalResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+
+	journal, completed, err := openJournal(path, false, false)
+	if err != nil {
+		t.Fatalf("openJournal() error = %v", err)
+	}
+	if len(completed) != 0 {
+		t.Errorf("expected a fresh journal to have no entries, got %d", len(completed))
+	}
+	journal.Record(OfficeList{Bioguide: "A000001", Offices: []OfficeInfo{{Address: "1 Main St"}}})
+	journal.Record(OfficeList{Bioguide: "B000002"})
+	journal.Close()
+
+	// simulate a crash partway through writing a line
+	file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	file.WriteString(`{"bioguide":"C0000`)
+	file.Close()
+
+	journal, completed, err = openJournal(path, true, false)
+	if err != nil {
+		t.Fatalf("openJournal() error = %v", err)
+	}
+	if len(completed) != 2 || completed[0].Bioguide != "A000001" || completed[0].Offices[0].Address != "1 Main St" {
+		t.Errorf("expected the two complete entries back, got %+v", completed)
+	}
+	// the cut off line is gone, so the redone legislator gets a line of its own
+	journal.Record(OfficeList{Bioguide: "C000003"})
+	journal.Close()
+	completed, err = readJournal(path)
+	if err != nil || len(completed) != 3 || completed[2].Bioguide != "C000003" {
+		t.Errorf("expected three entries after resuming, got %+v, %v", completed, err)
+	}
+
+	// starting over would lose the interrupted run's progress
+	_, _, err = openJournal(path, false, false)
+	if err == nil {
+		t.Errorf("expected an error starting over on an unfinished journal without force")
+	}
+
+	journal, completed, err = openJournal(path, false, true)
+	if err != nil {
+		t.Fatalf("openJournal() error = %v", err)
+	}
+	journal.Close()
+	if len(completed) != 0 {
+		t.Errorf("expected starting without resume to ignore the old journal, got %d entries", len(completed))
+	}
+	if data, _ := os.ReadFile(path); len(data) != 0 {
+		t.Errorf("expected forcing a new run to clear the old journal")
+	}
+}
+
+func TestJournalPath(t *testing.T) {
+	if path := (legislatorFilter{}).journalPath(); path != JournalFile {
+		t.Errorf("expected a full run to use %s, got %s", JournalFile, path)
+	}
+
+	il := legislatorFilter{States: []string{"il", "CA"}}
+	if il.journalPath() == JournalFile || il.journalPath() == (legislatorFilter{States: []string{"IL"}}).journalPath() {
+		t.Errorf("expected filtered runs to get journals of their own, got %s", il.journalPath())
+	}
+	if il.journalPath() != (legislatorFilter{States: []string{"CA", "IL"}}).journalPath() {
+		t.Errorf("expected the same filters in any order to share a journal")
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/sashabaranov/go-openai/jsonschema"
+)
+
+// LLMProvider is anything that can answer one of our prompts about some page content. When a
+// schema is given the response should be json matching it, otherwise it's plain text
+type LLMProvider interface {
+	Complete(ctx context.Context, prompt, content string, schema *ResponseSchema) (Completion, error)
+}
+
+// ResponseSchema is the json schema a structured response has to follow
+type ResponseSchema struct {
+	Name   string
+	Schema jsonschema.Definition
+}
+
+// Completion is a provider's answer along with the tokens it took
+type Completion struct {
+	Content string
+	Usage   TokenUsage
+}
+
+// TokenUsage counts the tokens used by one or more llm requests
+type TokenUsage struct {
+	Requests         int `json:"requests"`
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+func (u *TokenUsage) Add(other TokenUsage) {
+	u.Requests += other.Requests
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+}
+
+type usageContextKey struct{}
+
+// withUsage returns a context where every llm request made with it adds its usage to usage, so
+// per legislator totals don't have to be passed back up through every function
+func withUsage(ctx context.Context, usage *TokenUsage) context.Context {
+	return context.WithValue(ctx, usageContextKey{}, usage)
+}
+
+func usageFromContext(ctx context.Context) *TokenUsage {
+	usage, _ := ctx.Value(usageContextKey{}).(*TokenUsage)
+	return usage
+}
+
+// the provider used by findAddresses, set up by the scrape command from flags or env
+var llmProvider LLMProvider
+
+const (
+	ProviderOpenAI           = "openai"
+	ProviderOpenAICompatible = "openai-compatible"
+	ProviderFake             = "fake"
+)
+
+// LLMConfig describes which provider to use and how to reach it
+type LLMConfig struct {
+	Provider string
+	BaseURL  string
+	Model    string
+	APIKey   string
+	// optional, used for retries on the openai providers
+	HTTPClient *http.Client
+}
+
+// newLLMProvider picks a provider implementation by name. openai-compatible is for local servers
+// like llama.cpp or ollama that speak the openai api at some other base url, where an api key is
+// usually not required
+func newLLMProvider(llmConfig LLMConfig) (LLMProvider, error) {
+	switch llmConfig.Provider {
+	case ProviderOpenAI, "":
+		if llmConfig.APIKey == "" {
+			return nil, fmt.Errorf("no OpenAI token found")
+		}
+	case ProviderOpenAICompatible:
+		if llmConfig.BaseURL == "" {
+			return nil, fmt.Errorf("the %s provider needs a base url", llmConfig.Provider)
+		}
+	case ProviderFake:
+		return &FakeProvider{}, nil
+	default:
+		return nil, fmt.Errorf("unknown llm provider %q", llmConfig.Provider)
+	}
+
+	config := openai.DefaultConfig(llmConfig.APIKey)
+	if llmConfig.BaseURL != "" {
+		config.BaseURL = llmConfig.BaseURL
+	}
+	if llmConfig.HTTPClient != nil {
+		config.HTTPClient = llmConfig.HTTPClient
+	}
+
+	return &OpenAIProvider{client: openai.NewClientWithConfig(config), model: llmConfig.Model}, nil
+}
+
+// estimateTokens roughly counts the tokens in some text for rate limiting, using the usual rule
+// of thumb of four characters per token for english
+func estimateTokens(text string) int {
+	return len(text)/4 + 1
+}
+
+// OpenAIProvider talks to openai or any server implementing the chat completions api
+type OpenAIProvider struct {
+	client *openai.Client
+	model  string
+}
+
+func (p *OpenAIProvider) Complete(ctx context.Context, prompt, content string, schema *ResponseSchema) (Completion, error) {
+	model := p.model
+	if model == "" {
+		model = openai.GPT4oMini
+	}
+
+	request := openai.ChatCompletionRequest{
+		Model: model,
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleSystem,
+				Content: prompt,
+			},
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: content,
+			},
+		},
+	}
+
+	// when asking for json formatted information, providing a schema makes the resulting data much
+	// more reliable without having to add too much extra prompt text
+	if schema != nil {
+		request.ResponseFormat = &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+			JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+				Strict: true,
+				Name:   schema.Name,
+				Schema: schema.Schema,
+			},
+		}
+	}
+
+	resp, err := p.client.CreateChatCompletion(ctx, request)
+	if err != nil {
+		return Completion{}, err
+	}
+
+	completion := Completion{Usage: TokenUsage{
+		Requests:         1,
+		PromptTokens:     resp.Usage.PromptTokens,
+		CompletionTokens: resp.Usage.CompletionTokens,
+	}}
+	if len(resp.Choices) == 0 {
+		return completion, fmt.Errorf("no choices in completion response")
+	}
+	completion.Content = resp.Choices[0].Message.Content
+
+	return completion, nil
+}
+
+var addressResponseSchema = &ResponseSchema{Name: "address_response", Schema: jsonschema.Definition{
+	Type: jsonschema.Object,
+	Properties: map[string]jsonschema.Definition{
+		"addresses": {
+			Type: jsonschema.Array,
+			Items: &jsonschema.Definition{
+				Type: jsonschema.Object,
+				Properties: map[string]jsonschema.Definition{
+					"address": {
+						Type:        jsonschema.String,
+						Description: "The street address of the office",
+					},
+					"city": {
+						Type:        jsonschema.String,
+						Description: "The city where the office is located",
+					},
+					"state": {
+						Type:        jsonschema.String,
+						Description: "The state where the office is located",
+					},
+					"zip": {
+						Type:        jsonschema.String,
+						Description: "The ZIP code of the office",
+					},
+					"phone": {
+						Type:        jsonschema.String,
+						Description: "The phone number of the office",
+					},
+					"fax": {
+						Type:        jsonschema.String,
+						Description: "The fax number of the office",
+					},
+					"suite": {
+						Type:        jsonschema.String,
+						Description: "The suite number or floor of the office",
+					},
+					"building": {
+						Type:        jsonschema.String,
+						Description: "The building that the office is in",
+					},
+					"hours": {
+						Type:        jsonschema.String,
+						Description: "The days and times the office is open, as written on the page",
+					},
+				},
+				Required:             []string{"address", "city", "state", "zip", "phone", "fax", "suite", "building", "hours"},
+				AdditionalProperties: false,
+			},
+		},
+	},
+	Required:             []string{"addresses"},
+	AdditionalProperties: false,
+}}
+
+var locationsResponseSchema = &ResponseSchema{Name: "locations_response", Schema: jsonschema.Definition{
+	Type: jsonschema.Object,
+	Properties: map[string]jsonschema.Definition{
+		"url": {
+			Type:        jsonschema.String,
+			Description: "The link from the page most likely to list office locations, exactly as it appears in the href, or an empty string if there isn't one",
+		},
+	},
+	Required:             []string{"url"},
+	AdditionalProperties: false,
+}}
+
+// FakeProvider answers from canned responses keyed by prompt so scrapes can run without any
+// network access, mostly for tests. Unknown prompts get an empty json object
+type FakeProvider struct {
+	Responses map[string]string
+	// returned from every request when set
+	Err error
+
+	mu    sync.Mutex
+	Calls int
+}
+
+func (p *FakeProvider) Complete(ctx context.Context, prompt, content string, schema *ResponseSchema) (Completion, error) {
+	p.mu.Lock()
+	p.Calls++
+	p.mu.Unlock()
+	if p.Err != nil {
+		return Completion{}, p.Err
+	}
+
+	// pretend usage so accounting can be tested too
+	completion := Completion{Usage: TokenUsage{Requests: 1, PromptTokens: estimateTokens(prompt) + estimateTokens(content)}}
+	if response, ok := p.Responses[prompt]; ok {
+		completion.Content = response
+	} else if schema != nil {
+		completion.Content = `{}`
+	}
+	completion.Usage.CompletionTokens = estimateTokens(completion.Content)
+
+	return completion, nil
+}
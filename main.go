@@ -1,10 +1,12 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
 	_ "github.com/joho/godotenv/autoload"
 	"github.com/sashabaranov/go-openai"
@@ -15,6 +17,11 @@ type OfficeList struct {
 	Bioguide string       `json:"bioguide"`
 	URL      string       `json:"url"`
 	Offices  []OfficeInfo `json:"offices"`
+	// hash of the page text the offices were extracted from, to skip unchanged pages next run
+	ContentHash string `json:"content_hash,omitempty"`
+	// the pages the offices came from, where the next run starts when they aren't the main page
+	SourceURLs []string   `json:"source_urls,omitempty"`
+	Stale      *StaleInfo `json:"stale,omitempty"`
 }
 
 type OfficeInfo struct {
@@ -26,17 +33,21 @@ type OfficeInfo struct {
 	Zip      string `json:"zip"`
 	Phone    string `json:"phone,omitempty"`
 	Fax      string `json:"fax,omitempty"`
+	// normalized like "M-F 9AM-5PM"
+	Hours        string       `json:"hours,omitempty"`
+	OpeningHours *OfficeHours `json:"opening_hours,omitempty"`
+	// from a map or directions link on the office's page or offline geocoding
+	Latitude  float64 `json:"latitude,omitempty"`
+	Longitude float64 `json:"longitude,omitempty"`
+	// one of the GeoPrecision constants
+	GeoPrecision string `json:"geo_precision,omitempty"`
+	// how sure the heuristic extractor is about this office, from 0 to 1. Only its offices have
+	// one, so it also marks them as not from the llm
+	Confidence   float64             `json:"confidence,omitempty"`
+	Verification *OfficeVerification `json:"verification,omitempty"`
 }
 
-var openaiClient *openai.Client
-
 func main() {
-	openaiToken := os.Getenv("OPENAI_API_KEY")
-	if openaiToken == "" {
-		log.Fatal("no OpenAI token found")
-	}
-	openaiClient = openai.NewClient(openaiToken)
-
 	app := &cli.App{
 		Name:  "office-finder",
 		Usage: "A tool to scrape and process representative office addresses and phone numbers",
@@ -47,22 +58,190 @@ func main() {
 				Flags: []cli.Flag{
 					&cli.StringFlag{
 						Name:  "url",
-						Usage: "URL to scrape (optional, if not provided all URLs will be scraped)",
+						Usage: "URL to scrape (optional, if not provided all URLs will be scraped). Can be any page on a legislator's site, or with -bioguide any page at all",
+					},
+					&cli.StringSliceFlag{
+						Name:  "state",
+						Usage: "Only scrape legislators from this state, can be repeated",
+					},
+					&cli.StringFlag{
+						Name:  "chamber",
+						Usage: "Only scrape one chamber: rep or sen",
+					},
+					&cli.StringSliceFlag{
+						Name:  "bioguide",
+						Usage: "Only scrape the legislator with this bioguide ID, can be repeated",
+					},
+					&cli.StringFlag{
+						Name:  "bioguide-file",
+						Usage: "Only scrape the legislators with bioguide IDs listed in this file, one per line",
+					},
+					&cli.BoolFlag{
+						Name:  "only-missing",
+						Usage: "Only scrape legislators with no offices in offices.json",
+					},
+					&cli.BoolFlag{
+						Name:  "merge",
+						Usage: "Keep the previous offices.json entry for legislators whose scrape fails or finds nothing",
+						Value: false,
+					},
+					&cli.IntFlag{
+						Name:  "min-legislators",
+						Usage: "Refuse to write offices.json if fewer than this many legislators are resolved",
+						Value: DefaultMinLegislators,
+					},
+					&cli.StringFlag{
+						Name:  "extractor",
+						Usage: "How to extract offices from page text: llm, heuristic (no model calls) or check (llm, logging where the heuristic extractor disagrees)",
+						Value: ExtractorLLM,
+					},
+					&cli.StringFlag{
+						Name:  "structured-data",
+						Usage: "How to use schema.org address data published on pages: first (skip the llm when it lists more than one office and not only DC), check (compare with the llm) or off",
+						Value: StructuredFirst,
+					},
+					&cli.StringFlag{
+						Name:  "verify",
+						Usage: "Check that each office's phone, zip and street number appear on the page: flag (record the result), drop (remove offices that fail) or off",
+						Value: VerifyFlag,
+					},
+					&cli.StringFlag{
+						Name:  "discover",
+						Usage: "Look for office pages in the site's links and sitemap: fallback (when the first page has no offices), always (combine offices from every page) or off",
+						Value: DiscoverFallback,
+					},
+					&cli.IntFlag{
+						Name:  "discover-pages",
+						Usage: "Most candidate office pages to fetch per legislator when discovering",
+						Value: DefaultDiscoverPages,
+					},
+					&cli.IntFlag{
+						Name:  "chunk-tokens",
+						Usage: "Split page text longer than this many estimated tokens into overlapping chunks for the llm, 0 to never split",
+						Value: DefaultChunkTokens,
+					},
+					&cli.BoolFlag{
+						Name:  "prune",
+						Usage: "Remove navigation, scripts and blocks without addresses or phone numbers from pages before extraction, -prune=false to send whole pages",
+						Value: true,
+					},
+					&cli.BoolFlag{
+						Name:  "debug-prune",
+						Usage: "Log each page's size before and after pruning",
+					},
+					&cli.IntFlag{
+						Name:  "workers",
+						Usage: "How many legislators to scrape at once",
+						Value: DefaultWorkers,
+					},
+					&cli.Float64Flag{
+						Name:  "rate",
+						Usage: "Most page fetches per second across all sites, 0 for no limit",
+						Value: DefaultFetchRate,
+					},
+					&cli.Float64Flag{
+						Name:  "host-rate",
+						Usage: "Most page fetches per second to one domain, where all house.gov or senate.gov sites count as one. 0 for no limit",
+					},
+					&cli.Float64Flag{
+						Name:  "llm-rate",
+						Usage: "Most model requests per minute, 0 for no limit",
+					},
+					&cli.StringFlag{
+						Name:  "price-table",
+						Usage: "JSON file of model names to {\"prompt_per_million\": ..., \"completion_per_million\": ...} prices in USD, added to the built in prices",
+					},
+					&cli.Float64Flag{
+						Name:  "max-cost",
+						Usage: "Stop starting new extractions once the run has spent this many USD, 0 for no limit",
+					},
+					&cli.Float64Flag{
+						Name:  "llm-tpm",
+						Usage: "Most estimated prompt tokens per minute sent to the model, 0 for no limit",
+					},
+					&cli.DurationFlag{
+						Name:  "timeout",
+						Usage: "Stop a full scrape after this long and save the results so far, 0 for no limit",
+					},
+					&cli.DurationFlag{
+						Name:  "fetch-timeout",
+						Usage: "Deadline for fetching one page, including retries",
+						Value: DefaultFetchTimeout,
+					},
+					&cli.DurationFlag{
+						Name:  "llm-timeout",
+						Usage: "Deadline for one model request, including retries",
+						Value: DefaultLLMTimeout,
+					},
+					&cli.IntFlag{
+						Name:  "fetch-attempts",
+						Usage: "How many times to try fetching a page before giving up on 429s, 5xx responses or network errors",
+						Value: DefaultFetchRetryPolicy.MaxAttempts,
+					},
+					&cli.IntFlag{
+						Name:  "llm-attempts",
+						Usage: "How many times to try a model request before giving up on 429s, 5xx responses or network errors",
+						Value: DefaultLLMRetryPolicy.MaxAttempts,
+					},
+					&cli.DurationFlag{
+						Name:  "retry-delay",
+						Usage: "Initial delay between attempts, doubled each retry with jitter. Retry-After from the server takes precedence",
+						Value: DefaultFetchRetryPolicy.BaseDelay,
+					},
+					&cli.BoolFlag{
+						Name:  "force",
+						Usage: "Re-extract offices even for pages that haven't changed since the last run, and start over even if an interrupted run could be resumed",
+					},
+					&cli.StringFlag{
+						Name:  "report",
+						Usage: "Where to write the run report, as .json and .md files. Empty to skip it",
+						Value: DefaultReportFile,
+					},
+					&cli.BoolFlag{
+						Name:  "resume",
+						Usage: "Continue an interrupted scrape, skipping legislators already finished in its journal",
+					},
+					&cli.StringSliceFlag{
+						Name:  "geocode-data",
+						Usage: "Geocode offices without coordinates from this zip centroid, address range or address point file, can be repeated",
+					},
+					&cli.StringFlag{
+						Name:  "cache-dir",
+						Usage: "Directory to cache fetched pages in, empty to disable caching",
+						Value: DefaultCacheDir,
+					},
+					&cli.DurationFlag{
+						Name:  "cache-ttl",
+						Usage: "Serve cached pages younger than this without revalidating (e.g. 12h)",
+					},
+					&cli.BoolFlag{
+						Name:  "offline",
+						Usage: "Only use cached pages, never fetch from the network",
 					},
 					&cli.BoolFlag{
 						Name:  "debug",
 						Usage: "Enable debug mode",
 						Value: false,
 					},
+					&cli.StringFlag{
+						Name:    "llm",
+						Usage:   "LLM provider to extract with: openai, openai-compatible or fake",
+						Value:   ProviderOpenAI,
+						EnvVars: []string{"LLM_PROVIDER"},
+					},
+					&cli.StringFlag{
+						Name:    "llm-base-url",
+						Usage:   "Base URL for an openai-compatible server, e.g. http://localhost:8080/v1",
+						EnvVars: []string{"LLM_BASE_URL"},
+					},
+					&cli.StringFlag{
+						Name:    "llm-model",
+						Usage:   "Model name to request from the provider",
+						Value:   openai.GPT4oMini,
+						EnvVars: []string{"LLM_MODEL"},
+					},
 				},
-				Action: func(ctx *cli.Context) error {
-					url := ctx.String("url")
-					debug := ctx.Bool("debug")
-					if url == "" {
-						return scrapeAllURLs()
-					}
-					return scrapeOne(url, debug)
-				},
+				Action: runScrape,
 			},
 			{
 				Name:  "validate",
@@ -71,11 +250,31 @@ func main() {
 					return validateLegislators()
 				},
 			},
+			{
+				Name:  "geocode",
+				Usage: "Add coordinates to the offices in offices.json from local geocoding data",
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:     "data",
+						Usage:    "A zip centroid, address range or address point file to geocode with, can be repeated",
+						Required: true,
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					return geocodeOfficesFile(ctx.StringSlice("data"))
+				},
+			},
 			{
 				Name:  "upstreamChanges",
 				Usage: "Update the YAML file with office information from offices.json",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "include-unverified",
+						Usage: "Also add offices whose phone, zip or street number couldn't be found on their page",
+					},
+				},
 				Action: func(ctx *cli.Context) error {
-					return upstreamChanges()
+					return upstreamChanges(upstreamOptions{IncludeUnverified: ctx.Bool("include-unverified")})
 				},
 			},
 			{
@@ -94,32 +293,170 @@ func main() {
 	}
 }
 
-func validateLegislators() error {
-	repURLs := listRepURLs()
+// runScrape sets up the extraction dependencies from the scrape flags and runs either a full
+// scrape or a single url
+func runScrape(ctx *cli.Context) error {
+	findOpts := findOptions{
+		Debug:          ctx.Bool("debug"),
+		StructuredData: ctx.String("structured-data"),
+		Extractor:      ctx.String("extractor"),
+		Verify:         ctx.String("verify"),
+		Discover:       ctx.String("discover"),
+		DiscoverPages:  ctx.Int("discover-pages"),
+		ChunkTokens:    ctx.Int("chunk-tokens"),
+		Prune:          ctx.Bool("prune"),
+		DebugPrune:     ctx.Bool("debug-prune"),
+	}
+	switch findOpts.StructuredData {
+	case StructuredFirst, StructuredCheck, StructuredOff:
+	default:
+		return fmt.Errorf("unknown structured data mode %q", findOpts.StructuredData)
+	}
+	switch findOpts.Extractor {
+	case ExtractorLLM, ExtractorCheck, ExtractorHeuristic:
+	default:
+		return fmt.Errorf("unknown extractor %q", findOpts.Extractor)
+	}
+	switch findOpts.Verify {
+	case VerifyFlag, VerifyDrop, VerifyOff:
+	default:
+		return fmt.Errorf("unknown verify mode %q", findOpts.Verify)
+	}
+	switch findOpts.Discover {
+	case DiscoverFallback, DiscoverAlways, DiscoverOff:
+	default:
+		return fmt.Errorf("unknown discover mode %q", findOpts.Discover)
+	}
+
+	limits = newRateLimits(ctx.Float64("rate"), ctx.Float64("host-rate"), ctx.Float64("llm-rate"), ctx.Float64("llm-tpm"))
+
+	pageClient = newRetryClient("fetch", RetryPolicy{
+		MaxAttempts: ctx.Int("fetch-attempts"),
+		BaseDelay:   ctx.Duration("retry-delay"),
+		MaxDelay:    DefaultFetchRetryPolicy.MaxDelay,
+	})
 
-	// Read offices.json
-	officesData, err := os.ReadFile("offices.json")
+	prices, err := loadPriceTable(ctx.String("price-table"))
 	if err != nil {
-		return fmt.Errorf("error reading offices.json: %v", err)
+		return err
 	}
+	// the heuristic extractor never spends anything
+	var price ModelPrice
+	if findOpts.Extractor != ExtractorHeuristic {
+		price, err = modelPrice(prices, ctx.String("llm-model"), ctx.Float64("max-cost"))
+		if err != nil {
+			return err
+		}
+	}
+	spending = newSpendTracker(price, ctx.Float64("max-cost"))
+	defer spending.logTotals()
 
-	var officeList []OfficeList
-	err = json.Unmarshal(officesData, &officeList)
-	if err != nil {
-		return fmt.Errorf("error parsing offices.json: %v", err)
+	// the heuristic extractor never calls a model so doesn't need an api key
+	if findOpts.Extractor != ExtractorHeuristic {
+		provider, err := newLLMProvider(LLMConfig{
+			Provider: ctx.String("llm"),
+			BaseURL:  ctx.String("llm-base-url"),
+			Model:    ctx.String("llm-model"),
+			APIKey:   os.Getenv("OPENAI_API_KEY"),
+			HTTPClient: newRetryClient("llm", RetryPolicy{
+				MaxAttempts: ctx.Int("llm-attempts"),
+				BaseDelay:   ctx.Duration("retry-delay"),
+				MaxDelay:    DefaultLLMRetryPolicy.MaxDelay,
+			}),
+		})
+		if err != nil {
+			return err
+		}
+		llmProvider = provider
+	}
+
+	if len(ctx.StringSlice("geocode-data")) > 0 {
+		geocoder, err = loadGeocoder(ctx.StringSlice("geocode-data"))
+		if err != nil {
+			return err
+		}
 	}
 
-	existingOffices := map[string]bool{}
-	for _, office := range officeList {
-		if len(office.Offices) > 0 {
-			existingOffices[office.URL] = true
+	if ctx.String("cache-dir") != "" {
+		pageCache = &PageCache{
+			Dir:     ctx.String("cache-dir"),
+			TTL:     ctx.Duration("cache-ttl"),
+			Offline: ctx.Bool("offline"),
 		}
+	} else if ctx.Bool("offline") {
+		return fmt.Errorf("offline mode needs a cache directory")
 	}
 
-	for _, repURL := range repURLs {
-		if !existingOffices[repURL] {
-			log.Printf("didn't find offices for %s", repURL)
+	fetchTimeout = ctx.Duration("fetch-timeout")
+	llmTimeout = ctx.Duration("llm-timeout")
+
+	// ctrl-c or a kill stops the run early, and scrapeAllURLs saves what it has
+	runCtx, stop := signal.NotifyContext(ctx.Context, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if ctx.Duration("timeout") > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(runCtx, ctx.Duration("timeout"))
+		defer cancel()
+	}
+
+	filter := legislatorFilter{
+		States:      ctx.StringSlice("state"),
+		Chamber:     ctx.String("chamber"),
+		Bioguides:   ctx.StringSlice("bioguide"),
+		OnlyMissing: ctx.Bool("only-missing"),
+	}
+	if filter.Chamber != "" && filter.Chamber != "rep" && filter.Chamber != "sen" {
+		return fmt.Errorf("chamber should be rep or sen, not %q", filter.Chamber)
+	}
+	if ctx.String("bioguide-file") != "" {
+		bioguides, err := readBioguideFile(ctx.String("bioguide-file"))
+		if err != nil {
+			return err
 		}
+		filter.Bioguides = append(filter.Bioguides, bioguides...)
+	}
+
+	// a url, or a lone bioguide, is a quick scrape of one legislator
+	url := ctx.String("url")
+	bioguide := ""
+	if len(filter.Bioguides) == 1 && len(filter.States) == 0 && filter.Chamber == "" && !filter.OnlyMissing {
+		bioguide = filter.Bioguides[0]
+	}
+	if url != "" && len(filter.Bioguides) > 1 {
+		return fmt.Errorf("a url can only be scraped for one bioguide")
+	}
+	if url == "" && bioguide == "" {
+		return scrapeAllURLs(runCtx, scrapeOptions{
+			Merge:          ctx.Bool("merge"),
+			MinLegislators: ctx.Int("min-legislators"),
+			Force:          ctx.Bool("force"),
+			Workers:        ctx.Int("workers"),
+			Resume:         ctx.Bool("resume"),
+			ReportPath:     ctx.String("report"),
+			Filter:         filter,
+			Find:           findOpts,
+		})
+	}
+	return scrapeOne(runCtx, url, bioguide, findOpts)
+}
+
+func validateLegislators() error {
+	legislators, err := listCurrentLegislators(context.Background())
+	if err != nil {
+		return err
+	}
+
+	officeList, err := readOfficeList(OfficesFile)
+	if err != nil {
+		return err
+	}
+
+	repURLs := map[string]string{}
+	for _, legislator := range legislators {
+		repURLs[legislator.Bioguide] = legislator.URL
+	}
+	for _, bioguide := range legislatorsMissingOffices(legislators, officeList) {
+		log.Printf("didn't find offices for %s (%s)", repURLs[bioguide], bioguide)
 	}
 
 	// TODO: ensure offices listed are in the state they're supposed to be
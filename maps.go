@@ -0,0 +1,315 @@
+package main
+
+import (
+	"math"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// mapLink is a location pulled from an embedded map or directions link on a page
+type mapLink struct {
+	Latitude  float64
+	Longitude float64
+	// the address the link searches for, when it has one
+	Query string
+	// the link's text, or the title or alt text of a map embed or image
+	Label string
+	// byte offset of the link in the page, to find the office it's next to
+	Offset int
+}
+
+var (
+	// "39.8017,-89.6436" as used by q=, ll=, center= and friends
+	latLngRegex = regexp.MustCompile(`^\s*(-?\d{1,2}(?:\.\d+)?)\s*[,~_ ]\s*(-?\d{1,3}(?:\.\d+)?)\s*$`)
+	// google's /@39.8017,-89.6436,15z path segment
+	atLatLngRegex = regexp.MustCompile(`@(-?\d{1,2}\.\d+),(-?\d{1,3}\.\d+)`)
+	// google embed urls pack the pin into the pb parameter as !2d<lng>!3d<lat>
+	embedLatLngRegex = regexp.MustCompile(`!2d(-?\d{1,3}\.\d+)!3d(-?\d{1,2}\.\d+)`)
+	// openstreetmap's #map=15/39.8017/-89.6436
+	osmFragmentRegex = regexp.MustCompile(`map=\d+/(-?\d{1,2}\.\d+)/(-?\d{1,3}\.\d+)`)
+)
+
+// params holding a point, in the order we trust them. Destinations come before centers since a
+// directions link centered on the user's location is no use
+var latLngParams = []string{"daddr", "destination", "q", "query", "ll", "sll", "center", "cp", "marker"}
+
+// params holding an address to search for
+var queryParams = []string{"daddr", "destination", "q", "query", "address", "where1"}
+
+// extractMapLinks finds the map iframes, directions links and static map images on a page with
+// coordinates in them
+func extractMapLinks(source string) []mapLink {
+	var links []mapLink
+	tokenizer := html.NewTokenizer(strings.NewReader(source))
+	offset := 0
+	// the map link whose text we're in the middle of, if any
+	inLink := -1
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			break
+		}
+		raw := len(tokenizer.Raw())
+		switch tokenType {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			var link, label string
+			switch token.Data {
+			case "iframe", "img":
+				link = tokenAttr(token, "src")
+				label = tokenAttr(token, "title") + " " + tokenAttr(token, "alt") + " " + tokenAttr(token, "aria-label")
+			case "a":
+				link = tokenAttr(token, "href")
+				label = tokenAttr(token, "title") + " " + tokenAttr(token, "aria-label")
+			}
+			if parsed, ok := parseMapURL(link); ok {
+				parsed.Offset = offset
+				parsed.Label = strings.Join(strings.Fields(label), " ")
+				links = append(links, parsed)
+				if token.Data == "a" && tokenType == html.StartTagToken {
+					inLink = len(links) - 1
+				}
+			}
+		case html.TextToken:
+			if inLink >= 0 {
+				links[inLink].Label = strings.Join(strings.Fields(links[inLink].Label+" "+string(tokenizer.Text())), " ")
+			}
+		case html.EndTagToken:
+			if name, _ := tokenizer.TagName(); string(name) == "a" {
+				inLink = -1
+			}
+		}
+		offset += raw
+	}
+
+	return links
+}
+
+func tokenAttr(token html.Token, key string) string {
+	for _, a := range token.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// parseMapURL pulls a point out of a google, bing, openstreetmap or apple maps url
+func parseMapURL(link string) (mapLink, bool) {
+	parsed, err := url.Parse(strings.TrimSpace(link))
+	if err != nil || !isMapHost(parsed) {
+		return mapLink{}, false
+	}
+	params := parsed.Query()
+
+	var result mapLink
+	for _, param := range queryParams {
+		value := strings.TrimSpace(params.Get(param))
+		if value != "" && !latLngRegex.MatchString(value) {
+			result.Query = value
+			break
+		}
+	}
+	// google place urls put the address in the path instead
+	if result.Query == "" {
+		if i := strings.Index(parsed.Path, "/place/"); i >= 0 {
+			place := strings.SplitN(parsed.Path[i+len("/place/"):], "/", 2)[0]
+			result.Query = strings.ReplaceAll(place, "+", " ")
+		}
+	}
+
+	// pins win over the map's center, then search params, then wherever the map is looking
+	if match := embedLatLngRegex.FindStringSubmatch(link); match != nil {
+		return withPoint(result, match[2], match[1])
+	}
+	if mlat, mlon := params.Get("mlat"), params.Get("mlon"); mlat != "" && mlon != "" {
+		return withPoint(result, mlat, mlon)
+	}
+	for _, param := range latLngParams {
+		if match := latLngRegex.FindStringSubmatch(params.Get(param)); match != nil {
+			return withPoint(result, match[1], match[2])
+		}
+	}
+	if match := atLatLngRegex.FindStringSubmatch(parsed.Path); match != nil {
+		return withPoint(result, match[1], match[2])
+	}
+	if match := osmFragmentRegex.FindStringSubmatch(parsed.Fragment); match != nil {
+		return withPoint(result, match[1], match[2])
+	}
+
+	return mapLink{}, false
+}
+
+func isMapHost(parsed *url.URL) bool {
+	host := strings.TrimPrefix(strings.ToLower(parsed.Hostname()), "www.")
+	switch {
+	case strings.HasPrefix(host, "maps.google."), host == "maps.apple.com":
+		return true
+	case strings.HasPrefix(host, "google.") || host == "bing.com":
+		return strings.HasPrefix(parsed.Path, "/maps")
+	case host == "openstreetmap.org", strings.HasSuffix(host, ".openstreetmap.org"):
+		return true
+	}
+	return false
+}
+
+func withPoint(link mapLink, lat, lng string) (mapLink, bool) {
+	latitude, err := strconv.ParseFloat(lat, 64)
+	if err != nil {
+		return mapLink{}, false
+	}
+	longitude, err := strconv.ParseFloat(lng, 64)
+	if err != nil {
+		return mapLink{}, false
+	}
+	if math.Abs(latitude) > 90 || math.Abs(longitude) > 180 || (latitude == 0 && longitude == 0) {
+		return mapLink{}, false
+	}
+
+	link.Latitude = latitude
+	link.Longitude = longitude
+	return link, true
+}
+
+// furthest apart in the html a link and an office can be and still be paired up by position
+const maxMapLinkDistance = 2000
+
+// attachMapCoordinates gives offices the coordinates of the map links on their page. A link goes
+// to the office whose address it searches for, or else whose city is in its search or label. When
+// the links left over and the offices left over are the same in number, each link goes to the
+// nearest office in the page, if it's close by. Anything else, like a single map of the whole
+// district or a link to the capitol, isn't enough to place an office
+func attachMapCoordinates(offices []OfficeInfo, source string) []OfficeInfo {
+	links := extractMapLinks(source)
+	if len(links) == 0 || len(offices) == 0 {
+		return offices
+	}
+
+	used := make([]bool, len(links))
+	place := func(office, link int) {
+		offices[office].Latitude, offices[office].Longitude = links[link].Latitude, links[link].Longitude
+		offices[office].GeoPrecision = GeoPrecisionMapLink
+		used[link] = true
+	}
+
+	for i, link := range links {
+		if link.Query == "" {
+			continue
+		}
+		query := normalizeAddress(link.Query)
+		for j := range offices {
+			if offices[j].Latitude == 0 && offices[j].Address != "" && strings.Contains(query, normalizeAddress(offices[j].Address)) {
+				place(j, i)
+				break
+			}
+		}
+	}
+
+	for i, link := range links {
+		if used[i] {
+			continue
+		}
+		// only when the city picks out a single office, two offices in one city need addresses
+		described := mapWords(link.Query + " " + link.Label)
+		match := -1
+		for j := range offices {
+			city := mapWords(offices[j].City)
+			if offices[j].Latitude != 0 || city == " " || !strings.Contains(described, city) {
+				continue
+			}
+			if match >= 0 {
+				match = -1
+				break
+			}
+			match = j
+		}
+		if match >= 0 {
+			place(match, i)
+		}
+	}
+
+	var leftoverLinks, leftoverOffices []int
+	for i := range links {
+		if !used[i] {
+			leftoverLinks = append(leftoverLinks, i)
+		}
+	}
+	for j := range offices {
+		if offices[j].Latitude == 0 {
+			leftoverOffices = append(leftoverOffices, j)
+		}
+	}
+	if len(leftoverLinks) == 0 || len(leftoverLinks) != len(leftoverOffices) {
+		return offices
+	}
+
+	// pair up the rest closest first, so one link grabbing an office doesn't leave the next link
+	// with a worse match
+	type pairing struct {
+		link, office, distance int
+	}
+	var pairings []pairing
+	positions := officePositions(offices, source)
+	for _, i := range leftoverLinks {
+		for _, j := range leftoverOffices {
+			if positions[j] < 0 {
+				continue
+			}
+			distance := absInt(positions[j] - links[i].Offset)
+			if distance <= maxMapLinkDistance {
+				pairings = append(pairings, pairing{link: i, office: j, distance: distance})
+			}
+		}
+	}
+	sort.SliceStable(pairings, func(a, b int) bool {
+		return pairings[a].distance < pairings[b].distance
+	})
+	for _, p := range pairings {
+		if used[p.link] || offices[p.office].Latitude != 0 {
+			continue
+		}
+		place(p.office, p.link)
+	}
+
+	return offices
+}
+
+var nonWordRegex = regexp.MustCompile(`[^a-z0-9]+`)
+
+// mapWords lowercases text to its words with a space either side, so a city can be looked for
+// as whole words in a link's text
+func mapWords(text string) string {
+	return " " + strings.TrimSpace(nonWordRegex.ReplaceAllString(strings.ToLower(text), " ")) + " "
+}
+
+// officePositions finds roughly where in the page each office is listed, by its zip or else its
+// street address, or -1 when it can't be found
+func officePositions(offices []OfficeInfo, source string) []int {
+	positions := make([]int, len(offices))
+	for i, office := range offices {
+		positions[i] = -1
+		for _, needle := range []string{office.Zip, office.Address} {
+			if needle == "" {
+				continue
+			}
+			if position := strings.Index(source, needle); position >= 0 {
+				positions[i] = position
+				break
+			}
+		}
+	}
+
+	return positions
+}
+
+func absInt(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseMapURL(t *testing.T) {
+	testCases := []struct {
+		link      string
+		ok        bool
+		latitude  float64
+		longitude float64
+		query     string
+	}{
+		{"https://www.google.com/maps/embed?pb=!1m18!1m12!1m3!1d3066.1!2d-89.6436!3d39.8017!2m3!1f0", true, 39.8017, -89.6436, ""},
+		{"https://www.google.com/maps/place/100+Main+St,+Springfield,+IL+62701/@39.8017,-89.6436,17z", true, 39.8017, -89.6436, "100 Main St, Springfield, IL 62701"},
+		{"https://maps.google.com/?q=39.8017,-89.6436", true, 39.8017, -89.6436, ""},
+		{"https://maps.google.com/maps?daddr=100+Main+St+Springfield+IL&ll=39.8017,-89.6436", true, 39.8017, -89.6436, "100 Main St Springfield IL"},
+		{"https://www.bing.com/maps?cp=39.8017~-89.6436&lvl=16", true, 39.8017, -89.6436, ""},
+		{"https://www.openstreetmap.org/?mlat=39.8017&mlon=-89.6436#map=17/39.80/-89.64", true, 39.8017, -89.6436, ""},
+		{"https://www.openstreetmap.org/#map=17/39.8017/-89.6436", true, 39.8017, -89.6436, ""},
+		{"https://maps.apple.com/?ll=39.8017,-89.6436&q=Springfield%20Office", true, 39.8017, -89.6436, "Springfield Office"},
+		// an address alone has nothing to place the office with
+		{"https://maps.google.com/?q=100+Main+St+Springfield+IL", false, 0, 0, ""},
+		{"https://pelosi.house.gov/offices?q=39.8017,-89.6436", false, 0, 0, ""},
+		{"https://maps.google.com/?q=0,0", false, 0, 0, ""},
+	}
+
+	for _, tc := range testCases {
+		result, ok := parseMapURL(tc.link)
+		if ok != tc.ok || result.Latitude != tc.latitude || result.Longitude != tc.longitude || (tc.ok && result.Query != tc.query) {
+			t.Errorf("parseMapURL(%q) = %+v, %t, expected %v,%v %q, %t", tc.link, result, ok, tc.latitude, tc.longitude, tc.query, tc.ok)
+		}
+	}
+}
+
+func TestAttachMapCoordinates(t *testing.T) {
+	springfield := OfficeInfo{Address: "100 Main Street", City: "Springfield", State: "IL", Zip: "62701"}
+	peoria := OfficeInfo{Address: "200 Elm Street", City: "Peoria", State: "IL", Zip: "61602"}
+	dc := OfficeInfo{Address: "1 Independence Ave SE", City: "Washington", State: "DC", Zip: "20515"}
+	decatur := OfficeInfo{Address: "300 Oak Street", City: "Decatur", State: "IL", Zip: "62523"}
+	embed := func(lat, lng string) string {
+		return `<iframe src="https://www.google.com/maps/embed?pb=!1m18!2d` + lng + `!3d` + lat + `!2m3"></iframe>`
+	}
+	filler := "<p>" + strings.Repeat("Serving the people of the district. ", 100) + "</p>"
+
+	testCases := []struct {
+		name     string
+		page     string
+		offices  []OfficeInfo
+		expected [][2]float64
+	}{
+		{
+			name: "by address and then position",
+			page: `<div><p>100 Main Street</p><p>Springfield, IL 62701</p>` + embed("39.8017", "-89.6436") + `</div>
+<div><p>200 Elm Street</p><p>Peoria, IL 61602</p>` + embed("40.6936", "-89.5890") + `</div>
+<div><a href="https://www.google.com/maps/place/1+Independence+Ave+SE,+Washington,+DC/@38.8868,-77.0047,17z">Directions to our DC office</a></div>`,
+			offices:  []OfficeInfo{dc, peoria, springfield},
+			expected: [][2]float64{{38.8868, -77.0047}, {40.6936, -89.5890}, {39.8017, -89.6436}},
+		},
+		{
+			name: "by city in the link text",
+			page: `<p>100 Main Street, Springfield, IL 62701</p><p>200 Elm Street, Peoria, IL 61602</p>
+<a href="https://maps.google.com/?ll=40.6936,-89.5890">Directions to the Peoria office</a>
+<iframe title="Map of our Springfield office" src="https://www.google.com/maps/embed?pb=!1m18!2d-89.6436!3d39.8017!2m3"></iframe>`,
+			offices:  []OfficeInfo{springfield, peoria},
+			expected: [][2]float64{{39.8017, -89.6436}, {40.6936, -89.5890}},
+		},
+		{
+			// a single map of the district could be any of the offices
+			name:     "more offices than links",
+			page:     `<p>100 Main Street, Springfield, IL 62701</p>` + embed("40.0", "-89.0") + `<p>200 Elm Street, Peoria, IL 61602</p>`,
+			offices:  []OfficeInfo{springfield, peoria},
+			expected: [][2]float64{{0, 0}, {0, 0}},
+		},
+		{
+			name:     "link far from the office",
+			page:     `<p>300 Oak Street, Decatur, IL 62523</p>` + filler + embed("40.0", "-89.0"),
+			offices:  []OfficeInfo{decatur},
+			expected: [][2]float64{{0, 0}},
+		},
+	}
+
+	for _, tc := range testCases {
+		offices := attachMapCoordinates(append([]OfficeInfo{}, tc.offices...), tc.page)
+		for i, office := range offices {
+			if office.Latitude != tc.expected[i][0] || office.Longitude != tc.expected[i][1] {
+				t.Errorf("%s: office in %s got %v,%v, expected %v,%v", tc.name, office.City, office.Latitude, office.Longitude, tc.expected[i][0], tc.expected[i][1])
+			}
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// TimeRange is one stretch of opening hours, as 24 hour "09:00" times in the office's time zone
+type TimeRange struct {
+	Open  string `json:"open"`
+	Close string `json:"close"`
+}
+
+// OfficeHours is an office's weekly opening hours in a form apps can route calls with. Days with
+// no ranges are closed
+type OfficeHours struct {
+	Monday    []TimeRange `json:"monday,omitempty"`
+	Tuesday   []TimeRange `json:"tuesday,omitempty"`
+	Wednesday []TimeRange `json:"wednesday,omitempty"`
+	Thursday  []TimeRange `json:"thursday,omitempty"`
+	Friday    []TimeRange `json:"friday,omitempty"`
+	Saturday  []TimeRange `json:"saturday,omitempty"`
+	Sunday    []TimeRange `json:"sunday,omitempty"`
+	// IANA name like America/Chicago, from the hours themselves or the office's state
+	Timezone string `json:"timezone,omitempty"`
+	// the office only sees people by appointment, and there are no regular hours
+	AppointmentOnly bool `json:"appointment_only,omitempty"`
+	// appointments are available outside the regular hours
+	ByAppointment bool `json:"by_appointment,omitempty"`
+}
+
+// the earliest opening, latest closing and longest day we believe an office keeps, anything
+// outside them is much more likely a misread than real hours
+const (
+	earliestOpenMinutes = 5 * 60
+	latestCloseMinutes  = 23 * 60
+	longestDayMinutes   = 16 * 60
+)
+
+var timezoneAbbreviations = map[string]string{
+	"et": "America/New_York", "est": "America/New_York", "edt": "America/New_York", "eastern": "America/New_York",
+	"ct": "America/Chicago", "cst": "America/Chicago", "cdt": "America/Chicago", "central": "America/Chicago",
+	"mt": "America/Denver", "mst": "America/Denver", "mdt": "America/Denver", "mountain": "America/Denver",
+	"pt": "America/Los_Angeles", "pst": "America/Los_Angeles", "pdt": "America/Los_Angeles", "pacific": "America/Los_Angeles",
+	"akst": "America/Anchorage", "akdt": "America/Anchorage", "alaska": "America/Anchorage",
+	"hst": "Pacific/Honolulu", "hawaii": "Pacific/Honolulu",
+}
+
+var timezoneRegex = regexp.MustCompile(`(?i)\b(et|est|edt|eastern|ct|cst|cdt|central|mt|mst|mdt|mountain|pt|pst|pdt|pacific|akst|akdt|alaska|hst|hawaii)\b`)
+
+// each state's main time zone. Offices in the smaller part of a split state like the Florida
+// panhandle get the wrong zone unless their hours say which they mean
+var stateTimezones = map[string]string{
+	"AL": "America/Chicago", "AK": "America/Anchorage", "AZ": "America/Phoenix", "AR": "America/Chicago",
+	"CA": "America/Los_Angeles", "CO": "America/Denver", "CT": "America/New_York", "DE": "America/New_York",
+	"DC": "America/New_York", "FL": "America/New_York", "GA": "America/New_York", "HI": "Pacific/Honolulu",
+	"ID": "America/Boise", "IL": "America/Chicago", "IN": "America/Indiana/Indianapolis", "IA": "America/Chicago",
+	"KS": "America/Chicago", "KY": "America/New_York", "LA": "America/Chicago", "ME": "America/New_York",
+	"MD": "America/New_York", "MA": "America/New_York", "MI": "America/Detroit", "MN": "America/Chicago",
+	"MS": "America/Chicago", "MO": "America/Chicago", "MT": "America/Denver", "NE": "America/Chicago",
+	"NV": "America/Los_Angeles", "NH": "America/New_York", "NJ": "America/New_York", "NM": "America/Denver",
+	"NY": "America/New_York", "NC": "America/New_York", "ND": "America/Chicago", "OH": "America/New_York",
+	"OK": "America/Chicago", "OR": "America/Los_Angeles", "PA": "America/New_York", "RI": "America/New_York",
+	"SC": "America/New_York", "SD": "America/Chicago", "TN": "America/Chicago", "TX": "America/Chicago",
+	"UT": "America/Denver", "VT": "America/New_York", "VA": "America/New_York", "WA": "America/Los_Angeles",
+	"WV": "America/New_York", "WI": "America/Chicago", "WY": "America/Denver", "PR": "America/Puerto_Rico",
+	"GU": "Pacific/Guam", "VI": "America/St_Thomas", "AS": "Pacific/Pago_Pago", "MP": "Pacific/Saipan",
+}
+
+var (
+	// "By appointment only", "Appointments only" or "Open by appointment"
+	appointmentOnlyRegex = regexp.MustCompile(`(?i)\bby appointment\b|\bappointments? only\b`)
+	// "no appointment necessary" or "appointments aren't required" mean the opposite
+	noAppointmentRegex = regexp.MustCompile(`(?i)\b(?:no|not|without)\s+(?:an\s+)?appointments?\b|\bappointments?\s+(?:are\s+|is\s+)?(?:not|aren't|isn't)\s+(?:required|necessary|needed)\b`)
+)
+
+// days returns the ranges of each day of the week, monday first, for looping over
+func (h *OfficeHours) days() [7]*[]TimeRange {
+	return [7]*[]TimeRange{&h.Monday, &h.Tuesday, &h.Wednesday, &h.Thursday, &h.Friday, &h.Saturday, &h.Sunday}
+}
+
+// parseOfficeHours reads hours text into structured hours. The state is used for the time zone
+// when the text doesn't give one. Hours that don't say which days they're for can't be
+// structured, so they aren't
+func parseOfficeHours(text, state string) (*OfficeHours, bool) {
+	text = strings.Join(strings.Fields(text), " ")
+	if text == "" {
+		return nil, false
+	}
+
+	hours := &OfficeHours{Timezone: stateTimezones[strings.ToUpper(strings.ReplaceAll(state, ".", ""))]}
+	if match := timezoneRegex.FindString(text); match != "" {
+		hours.Timezone = timezoneAbbreviations[strings.ToLower(match)]
+	}
+
+	segments := parseHoursSegments(text)
+	if len(segments) == 0 {
+		if appointmentOnlyRegex.MatchString(text) && !noAppointmentRegex.MatchString(text) {
+			hours.AppointmentOnly = true
+			return hours, true
+		}
+		return nil, false
+	}
+
+	days := hours.days()
+	for _, segment := range segments {
+		if len(segment.Days) == 0 {
+			return nil, false
+		}
+		for _, day := range segment.Days {
+			for _, r := range segment.Ranges {
+				*days[day] = append(*days[day], TimeRange{Open: formatClock24(r.Open), Close: formatClock24(r.Close)})
+			}
+		}
+	}
+	for _, ranges := range days {
+		sort.Slice(*ranges, func(i, j int) bool {
+			return (*ranges)[i].Open < (*ranges)[j].Open
+		})
+	}
+	hours.ByAppointment = appointmentRegex.MatchString(text)
+
+	return hours, true
+}
+
+// Validate checks the hours are ones an office could plausibly keep: each range opens before it
+// closes, within the day, and ranges on the same day don't overlap
+func (h *OfficeHours) Validate() error {
+	for i, ranges := range h.days() {
+		previousClose := -1
+		for _, r := range *ranges {
+			open, err := parseClock24(r.Open)
+			if err != nil {
+				return err
+			}
+			close, err := parseClock24(r.Close)
+			if err != nil {
+				return err
+			}
+
+			day := hoursDayNames[i]
+			switch {
+			case close <= open:
+				return fmt.Errorf("%s closes at %s before it opens at %s", day, r.Close, r.Open)
+			case open < earliestOpenMinutes || close > latestCloseMinutes:
+				return fmt.Errorf("%s hours %s-%s are outside the day", day, r.Open, r.Close)
+			case close-open > longestDayMinutes:
+				return fmt.Errorf("%s hours %s-%s are too long", day, r.Open, r.Close)
+			case open < previousClose:
+				return fmt.Errorf("%s hours overlap at %s", day, r.Open)
+			}
+			previousClose = close
+		}
+	}
+
+	return nil
+}
+
+// String writes the hours in the upstream format, like "M-Th 9AM-5PM; F 9AM-3PM"
+func (h *OfficeHours) String() string {
+	if h.AppointmentOnly {
+		return "By appointment only"
+	}
+
+	// days with the same hours are written together, in the order they first come up
+	var segments []hoursSegment
+	index := map[string]int{}
+	for day, ranges := range h.days() {
+		if len(*ranges) == 0 {
+			continue
+		}
+		var key []string
+		var minutes []hoursRange
+		for _, r := range *ranges {
+			open, _ := parseClock24(r.Open)
+			close, _ := parseClock24(r.Close)
+			minutes = append(minutes, hoursRange{Open: open, Close: close})
+			key = append(key, r.Open+"-"+r.Close)
+		}
+		k := strings.Join(key, ",")
+		if i, ok := index[k]; ok {
+			segments[i].Days = append(segments[i].Days, day)
+			continue
+		}
+		index[k] = len(segments)
+		segments = append(segments, hoursSegment{Days: []int{day}, Ranges: minutes})
+	}
+
+	formatted := formatHoursSegments(segments)
+	if h.ByAppointment {
+		formatted += "; by appointment"
+	}
+
+	return formatted
+}
+
+func formatClock24(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+func parseClock24(clock string) (int, error) {
+	var hour, minute int
+	_, err := fmt.Sscanf(clock, "%d:%d", &hour, &minute)
+	if err != nil || hour < 0 || hour > 24 || minute < 0 || minute > 59 {
+		return 0, fmt.Errorf("bad time %q", clock)
+	}
+	return hour*60 + minute, nil
+}
+
+// structureOfficeHours fills in an office's structured hours from its hours text, and rewrites the
+// text from them so the two agree. Hours that can't be structured or don't validate are left as
+// normalized text only, for someone to check by hand
+func structureOfficeHours(office *OfficeInfo) {
+	office.OpeningHours = nil
+	if office.Hours == "" {
+		return
+	}
+
+	hours, ok := parseOfficeHours(office.Hours, office.State)
+	if ok {
+		err := hours.Validate()
+		if err != nil {
+			log.Printf("ignoring implausible hours %q for office in %s: %v", office.Hours, office.City, err)
+			ok = false
+		}
+	}
+	if !ok {
+		office.Hours = normalizeHours(office.Hours)
+		return
+	}
+
+	office.OpeningHours = hours
+	office.Hours = hours.String()
+}
+
+// officeHoursText is the hours to publish upstream, written from the structured hours in case
+// offices.json was edited by hand. Hours that don't structure and validate aren't published
+func officeHoursText(office OfficeInfo) string {
+	if office.OpeningHours == nil {
+		// offices.json from before hours were structured, or edited by hand
+		structureOfficeHours(&office)
+	}
+	if office.OpeningHours == nil {
+		return ""
+	}
+	return office.OpeningHours.String()
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseOfficeHours(t *testing.T) {
+	weekdays := func(ranges ...TimeRange) OfficeHours {
+		return OfficeHours{Monday: ranges, Tuesday: ranges, Wednesday: ranges, Thursday: ranges, Friday: ranges}
+	}
+	nineToFive := TimeRange{Open: "09:00", Close: "17:00"}
+
+	testCases := []struct {
+		input    string
+		state    string
+		expected *OfficeHours
+		text     string
+	}{
+		{
+			input:    "Monday - Friday: 9:00 a.m. - 5:00 p.m.",
+			state:    "IL",
+			expected: func() *OfficeHours { h := weekdays(nineToFive); h.Timezone = "America/Chicago"; return &h }(),
+			text:     "M-F 9AM-5PM",
+		},
+		{
+			input: "Mon-Thu 9-5; Fri 9-3 (Eastern)",
+			state: "IN",
+			expected: &OfficeHours{
+				Monday: []TimeRange{nineToFive}, Tuesday: []TimeRange{nineToFive}, Wednesday: []TimeRange{nineToFive}, Thursday: []TimeRange{nineToFive},
+				Friday: []TimeRange{{Open: "09:00", Close: "15:00"}}, Timezone: "America/New_York",
+			},
+			text: "M-Th 9AM-5PM; F 9AM-3PM",
+		},
+		{
+			input: "Monday-Friday 9am-12pm, 1pm-5pm, Saturday by appointment",
+			state: "CA",
+			expected: func() *OfficeHours {
+				h := weekdays(TimeRange{Open: "09:00", Close: "12:00"}, TimeRange{Open: "13:00", Close: "17:00"})
+				h.Timezone, h.ByAppointment = "America/Los_Angeles", true
+				return &h
+			}(),
+			text: "M-F 9AM-12PM, 1PM-5PM; by appointment",
+		},
+		{
+			input:    "Appointments only",
+			state:    "IL",
+			expected: &OfficeHours{Timezone: "America/Chicago", AppointmentOnly: true},
+			text:     "By appointment only",
+		},
+		{
+			input:    "By appointment only",
+			state:    "N.M.",
+			expected: &OfficeHours{Timezone: "America/Denver", AppointmentOnly: true},
+			text:     "By appointment only",
+		},
+		// no days, so there's nothing to hang the times on
+		{input: "9:00 AM - 5:00 PM", state: "IL"},
+		{input: "Call for hours", state: "IL"},
+		// mentioning appointments isn't the same as only seeing people by one
+		{input: "Walk-ins welcome, no appointment necessary", state: "IL"},
+		{input: "Appointments are not required", state: "IL"},
+		{input: "Please call to schedule an appointment", state: "IL"},
+	}
+
+	for _, tc := range testCases {
+		hours, ok := parseOfficeHours(tc.input, tc.state)
+		if tc.expected == nil {
+			if ok {
+				t.Errorf("parseOfficeHours(%q) = %+v, expected no structured hours", tc.input, hours)
+			}
+			continue
+		}
+		if !ok {
+			t.Errorf("parseOfficeHours(%q) failed, expected %+v", tc.input, tc.expected)
+			continue
+		}
+		if !reflect.DeepEqual(hours, tc.expected) {
+			t.Errorf("parseOfficeHours(%q) = %+v, expected %+v", tc.input, hours, tc.expected)
+		}
+		if err := hours.Validate(); err != nil {
+			t.Errorf("parseOfficeHours(%q) didn't validate: %v", tc.input, err)
+		}
+		if text := hours.String(); text != tc.text {
+			t.Errorf("parseOfficeHours(%q).String() = %q, expected %q", tc.input, text, tc.text)
+		}
+	}
+}
+
+func TestOfficeHoursValidate(t *testing.T) {
+	testCases := []struct {
+		name  string
+		hours OfficeHours
+	}{
+		{"closes before it opens", OfficeHours{Monday: []TimeRange{{Open: "17:00", Close: "09:00"}}}},
+		{"opens too early", OfficeHours{Tuesday: []TimeRange{{Open: "03:00", Close: "12:00"}}}},
+		{"closes too late", OfficeHours{Friday: []TimeRange{{Open: "09:00", Close: "23:30"}}}},
+		{"too long", OfficeHours{Saturday: []TimeRange{{Open: "05:00", Close: "22:00"}}}},
+		{"overlapping", OfficeHours{Wednesday: []TimeRange{{Open: "09:00", Close: "13:00"}, {Open: "12:00", Close: "17:00"}}}},
+		{"bad time", OfficeHours{Thursday: []TimeRange{{Open: "9am", Close: "17:00"}}}},
+	}
+
+	for _, tc := range testCases {
+		if err := tc.hours.Validate(); err == nil {
+			t.Errorf("%s: expected a validation error for %+v", tc.name, tc.hours)
+		}
+	}
+}
+
+func TestStructureOfficeHours(t *testing.T) {
+	office := OfficeInfo{City: "Springfield", State: "IL", Hours: "Mon-Fri 9am to 5:30pm"}
+	structureOfficeHours(&office)
+	if office.OpeningHours == nil || office.OpeningHours.Friday[0].Close != "17:30" {
+		t.Errorf("expected structured hours, got %+v", office.OpeningHours)
+	}
+	if office.Hours != "M-F 9AM-5:30PM" {
+		t.Errorf("expected hours text from the structured hours, got %q", office.Hours)
+	}
+
+	// implausible hours are kept as text only
+	office = OfficeInfo{City: "Springfield", State: "IL", Hours: "Monday - Friday 2am - 5pm"}
+	structureOfficeHours(&office)
+	if office.OpeningHours != nil {
+		t.Errorf("expected implausible hours to be left unstructured, got %+v", office.OpeningHours)
+	}
+	if office.Hours != "M-F 2AM-5PM" {
+		t.Errorf("expected normalized hours text, got %q", office.Hours)
+	}
+	if hours := officeHoursText(office); hours != "" {
+		t.Errorf("expected implausible hours to stay out of upstream, got %q", hours)
+	}
+
+	// so are hours that don't say which days they're for
+	office = OfficeInfo{City: "Springfield", State: "IL", Hours: "9:00 AM - 5:00 PM"}
+	if hours := officeHoursText(office); hours != "" {
+		t.Errorf("expected unstructured hours to stay out of upstream, got %q", hours)
+	}
+	office.Hours = "Weekdays 9-5"
+	if hours := officeHoursText(office); hours != "M-F 9AM-5PM" {
+		t.Errorf("expected hours text structured for upstream, got %q", hours)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+const OfficesFile = "offices.json"
+
+// StaleInfo marks an entry in offices.json that was carried over from a previous run because the
+// latest scrape for that legislator failed or came back empty
+type StaleInfo struct {
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+func readOfficeList(path string) ([]OfficeList, error) {
+	officesData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", path, err)
+	}
+
+	var officeList []OfficeList
+	err = json.Unmarshal(officesData, &officeList)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", path, err)
+	}
+
+	return officeList, nil
+}
+
+func writeOfficeList(path string, officeList []OfficeList) error {
+	data, err := json.MarshalIndent(officeList, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling office list: %v", err)
+	}
+
+	err = os.WriteFile(path, data, 0644)
+	if err != nil {
+		return fmt.Errorf("error writing %s: %v", path, err)
+	}
+
+	return nil
+}
+
+// mergeOfficeLists keeps the previous entry for any legislator whose scrape failed or found no
+// offices, marking it stale with the reason. Legislators that succeeded replace their previous
+// entries entirely. The bioguides that fell back are returned for the run summary
+func mergeOfficeLists(previous, results []OfficeList, failures map[string]error, now time.Time) ([]OfficeList, []string) {
+	previousByBioguide := map[string]OfficeList{}
+	for _, leg := range previous {
+		previousByBioguide[leg.Bioguide] = leg
+	}
+
+	var merged []OfficeList
+	var fellBack []string
+	seen := map[string]bool{}
+
+	for _, leg := range results {
+		seen[leg.Bioguide] = true
+		prev, ok := previousByBioguide[leg.Bioguide]
+		if len(leg.Offices) > 0 || !ok || len(prev.Offices) == 0 {
+			merged = append(merged, leg)
+			continue
+		}
+
+		prev.Stale = &StaleInfo{Error: "no offices found", FailedAt: now}
+		merged = append(merged, prev)
+		fellBack = append(fellBack, leg.Bioguide)
+	}
+
+	for bioguide, scrapeErr := range failures {
+		if seen[bioguide] {
+			continue
+		}
+		prev, ok := previousByBioguide[bioguide]
+		if !ok {
+			continue
+		}
+
+		prev.Stale = &StaleInfo{Error: scrapeErr.Error(), FailedAt: now}
+		merged = append(merged, prev)
+		fellBack = append(fellBack, bioguide)
+	}
+
+	return merged, fellBack
+}
+
+// keepUnscraped fills in the previous entries for current legislators that an interrupted run
+// didn't get to, so saving a partial run doesn't drop anyone
+func keepUnscraped(previous, results []OfficeList, current map[string]string) []OfficeList {
+	scraped := map[string]bool{}
+	for _, leg := range results {
+		scraped[leg.Bioguide] = true
+	}
+
+	for _, leg := range previous {
+		if _, ok := current[leg.Bioguide]; ok && !scraped[leg.Bioguide] {
+			results = append(results, leg)
+		}
+	}
+
+	return results
+}
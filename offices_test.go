@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestMergeOfficeLists(t *testing.T) {
+	now := time.Date(2024, 11, 6, 0, 0, 0, 0, time.UTC)
+	previous := []OfficeList{
+		{Bioguide: "A000001", URL: "https://a.house.gov", Offices: []OfficeInfo{{Address: "1 Old St", City: "Alpha"}}},
+		{Bioguide: "B000002", URL: "https://b.house.gov", Offices: []OfficeInfo{{Address: "2 Old St", City: "Beta"}}},
+		{Bioguide: "C000003", URL: "https://c.house.gov", Offices: []OfficeInfo{{Address: "3 Old St", City: "Gamma"}}},
+	}
+	results := []OfficeList{
+		{Bioguide: "A000001", URL: "https://a.house.gov", Offices: []OfficeInfo{{Address: "1 New St", City: "Alpha"}}},
+		{Bioguide: "C000003", URL: "https://c.house.gov"},
+		{Bioguide: "D000004", URL: "https://d.house.gov"},
+	}
+	failures := map[string]error{
+		"B000002": fmt.Errorf("status code 500"),
+		"E000005": fmt.Errorf("status code 404"),
+	}
+
+	merged, fellBack := mergeOfficeLists(previous, results, failures, now)
+
+	byBioguide := map[string]OfficeList{}
+	for _, leg := range merged {
+		byBioguide[leg.Bioguide] = leg
+	}
+
+	if len(merged) != 4 {
+		t.Fatalf("expected 4 merged legislators, got %d: %+v", len(merged), merged)
+	}
+	if leg := byBioguide["A000001"]; leg.Offices[0].Address != "1 New St" || leg.Stale != nil {
+		t.Errorf("successful scrape should replace previous entry, got %+v", leg)
+	}
+	if leg := byBioguide["B000002"]; leg.Offices[0].Address != "2 Old St" || leg.Stale == nil || leg.Stale.Error != "status code 500" || !leg.Stale.FailedAt.Equal(now) {
+		t.Errorf("failed scrape should keep previous entry marked stale, got %+v", leg)
+	}
+	if leg := byBioguide["C000003"]; leg.Offices[0].Address != "3 Old St" || leg.Stale == nil {
+		t.Errorf("empty scrape should keep previous entry marked stale, got %+v", leg)
+	}
+	if leg, ok := byBioguide["D000004"]; !ok || len(leg.Offices) != 0 {
+		t.Errorf("empty scrape with no previous entry should be kept as is, got %+v", leg)
+	}
+	if _, ok := byBioguide["E000005"]; ok {
+		t.Errorf("failed scrape with no previous entry should not be added")
+	}
+	if len(fellBack) != 2 {
+		t.Errorf("expected 2 fallbacks, got %v", fellBack)
+	}
+}
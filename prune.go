@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// elements that never hold office details but do hold plenty of tokens
+var boilerplateElements = map[string]bool{
+	"script":   true,
+	"style":    true,
+	"noscript": true,
+	"template": true,
+	"svg":      true,
+	"nav":      true,
+	"header":   true,
+	"form":     true,
+	"button":   true,
+	"select":   true,
+}
+
+var blockElements = map[string]bool{
+	"div": true, "section": true, "article": true, "aside": true, "main": true, "footer": true,
+	"address": true, "p": true, "li": true, "ul": true, "ol": true, "td": true, "tr": true,
+	"table": true, "dl": true, "dd": true,
+}
+
+// "IL 62701" anywhere in a block
+var stateZipSignalRegex = regexp.MustCompile(`\b([A-Z]\.?[A-Z])\.?,?\s+\d{5}(?:-\d{4})?\b`)
+
+// a signal block's parent is kept instead when it's no bigger than this, so office names and
+// hours next to an address come along with it
+const maxPruneBlockChars = 2000
+
+// blocks scoring less than this fraction of the best block are dropped
+const minPruneDensityRatio = 0.1
+
+type prunedBlock struct {
+	node    *html.Node
+	order   int
+	density float64
+}
+
+// pruneBoilerplate cuts a page down to the parts likely to hold office details before it's turned
+// into text. Navigation, scripts and the like are removed, then the blocks with addresses or phone
+// numbers in them are ranked by how densely they hold them and the weak ones dropped. A page with
+// no addresses or phone numbers at all is returned with just the boilerplate removed, so the
+// fallbacks still have something to look at
+func pruneBoilerplate(source string) string {
+	doc, err := html.Parse(strings.NewReader(source))
+	if err != nil {
+		return source
+	}
+	removeBoilerplate(doc)
+
+	// number every node so kept blocks can go back in page order
+	order := map[*html.Node]int{}
+	var number func(n *html.Node)
+	number = func(n *html.Node) {
+		order[n] = len(order)
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			number(c)
+		}
+	}
+	number(doc)
+
+	// the smallest blocks with a signal in them, grown to their parent when that's still small
+	selected := map[*html.Node]bool{}
+	var find func(n *html.Node) bool
+	find = func(n *html.Node) bool {
+		childHasSignal := false
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if find(c) {
+				childHasSignal = true
+			}
+		}
+		if childHasSignal {
+			return true
+		}
+		if n.Type != html.ElementNode || !blockElements[n.Data] || officeSignals(nodeText(n)) == 0 {
+			return false
+		}
+
+		block := n
+		for parent := n.Parent; parent != nil; parent = parent.Parent {
+			if parent.Type == html.ElementNode && blockElements[parent.Data] {
+				if len(strings.TrimSpace(nodeText(parent))) <= maxPruneBlockChars {
+					block = parent
+				}
+				break
+			}
+		}
+		selected[block] = true
+		return true
+	}
+	find(doc)
+
+	var blocks []prunedBlock
+	for node := range selected {
+		// a block inside another kept block comes along with it
+		nested := false
+		for parent := node.Parent; parent != nil; parent = parent.Parent {
+			if selected[parent] {
+				nested = true
+				break
+			}
+		}
+		if nested {
+			continue
+		}
+
+		text := nodeText(node)
+		blocks = append(blocks, prunedBlock{
+			node:    node,
+			order:   order[node],
+			density: float64(officeSignals(text)) / (float64(len(strings.Fields(text))) + 1),
+		})
+	}
+	if len(blocks) == 0 {
+		return renderNode(doc)
+	}
+
+	best := 0.0
+	for _, block := range blocks {
+		if block.density > best {
+			best = block.density
+		}
+	}
+	sort.Slice(blocks, func(i, j int) bool {
+		return blocks[i].order < blocks[j].order
+	})
+
+	var sb strings.Builder
+	sb.WriteString("<html><body>")
+	for _, block := range blocks {
+		if block.density < best*minPruneDensityRatio {
+			continue
+		}
+		sb.WriteString(renderNode(block.node))
+	}
+	sb.WriteString("</body></html>")
+
+	return sb.String()
+}
+
+func removeBoilerplate(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.CommentNode || (c.Type == html.ElementNode && (boilerplateElements[c.Data] || attr(c, "role") == "navigation")) {
+			n.RemoveChild(c)
+		} else {
+			removeBoilerplate(c)
+		}
+		c = next
+	}
+}
+
+// officeSignals counts the phone numbers and state and zip pairs in some text
+func officeSignals(text string) int {
+	signals := len(phoneRegex.FindAllString(text, -1))
+	for _, match := range stateZipSignalRegex.FindAllStringSubmatch(text, -1) {
+		if stateAbbreviations[strings.ToUpper(strings.ReplaceAll(match[1], ".", ""))] {
+			signals++
+		}
+	}
+
+	return signals
+}
+
+func renderNode(n *html.Node) string {
+	var buf bytes.Buffer
+	err := html.Render(&buf, n)
+	if err != nil {
+		return ""
+	}
+
+	return buf.String()
+}
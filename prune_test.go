@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPruneBoilerplate(t *testing.T) {
+	page := `<html><head><style>body { color: red }</style><script>var tracking = "(555) 555-5555";</script></head><body>
+<header><a href="/">Home</a> Call us (202) 225-0000</header>
+<nav><ul><li><a href="/issues">Issues</a></li><li><a href="/press">Press</a></li></ul></nav>
+<main>
+  <section class="press"><h2>Latest news</h2><ul><li>Congressman votes on the farm bill</li><li>Statement on the budget</li><li>Town hall recap</li></ul></section>
+  <section class="offices">
+    <div class="office"><h3>Springfield Office</h3><p>100 Main Street, Suite 200</p><p>Springfield, IL 62701</p><p>Phone: (217) 555-0100</p></div>
+    <div class="office"><h3>Peoria Office</h3><p>200 Elm Street</p><p>Peoria, IL 61602</p><p>Phone: (309) 555-0100</p></div>
+  </section>
+</main>
+<footer><p>1 Independence Ave SE, Washington, DC 20515</p><p>(202) 555-0100</p><a href="https://twitter.com/rep">Twitter</a></footer>
+</body></html>`
+
+	pruned := pruneBoilerplate(page)
+	for _, expected := range []string{"Springfield Office", "Springfield, IL 62701", "Peoria, IL 61602", "(309) 555-0100", "Washington, DC 20515"} {
+		if !strings.Contains(pruned, expected) {
+			t.Errorf("expected pruned page to keep %q, got %s", expected, pruned)
+		}
+	}
+	for _, unexpected := range []string{"tracking", "color: red", "Issues", "(202) 225-0000", "farm bill"} {
+		if strings.Contains(pruned, unexpected) {
+			t.Errorf("expected pruned page to drop %q, got %s", unexpected, pruned)
+		}
+	}
+	if len(pruned) >= len(page) {
+		t.Errorf("expected pruning to shrink the page, %d to %d bytes", len(page), len(pruned))
+	}
+
+	// with nothing that looks like an office, only the boilerplate goes
+	pruned = pruneBoilerplate(`<html><body><nav>Menu</nav><p>Find our offices on the contact page</p></body></html>`)
+	if !strings.Contains(pruned, "contact page") || strings.Contains(pruned, "Menu") {
+		t.Errorf("expected only boilerplate pruned from a page without offices, got %s", pruned)
+	}
+}
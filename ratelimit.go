@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultWorkers   = 5
+	DefaultFetchRate = 1.0
+)
+
+// tokenBucket lets through rate tokens per second with bursts of up to capacity. A nil bucket
+// never waits
+type tokenBucket struct {
+	mu       sync.Mutex
+	rate     float64
+	capacity float64
+	tokens   float64
+	last     time.Time
+}
+
+func newTokenBucket(rate, capacity float64) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+
+	return &tokenBucket{rate: rate, capacity: capacity, tokens: capacity, last: time.Now()}
+}
+
+// Wait blocks until n tokens are available and takes them. Asking for more than the bucket holds
+// waits for a full bucket
+func (b *tokenBucket) Wait(ctx context.Context, n float64) error {
+	if b == nil {
+		return nil
+	}
+	if n > b.capacity {
+		n = b.capacity
+	}
+
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	b.last = now
+
+	// take the tokens now, going negative if we have to, so later callers queue up behind us
+	b.tokens -= n
+	var delay time.Duration
+	if b.tokens < 0 {
+		delay = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.mu.Unlock()
+
+	if delay == 0 {
+		return nil
+	}
+	select {
+	case <-time.After(delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// rateLimits keeps scraping polite: a global limit on page fetches, a limit per site group since
+// many member sites share house.gov or senate.gov infrastructure, and limits on llm requests and
+// tokens per minute
+type rateLimits struct {
+	fetch *tokenBucket
+
+	hostRate float64
+	mu       sync.Mutex
+	hosts    map[string]*tokenBucket
+
+	llmRequests *tokenBucket
+	llmTokens   *tokenBucket
+}
+
+// the limits used by getPageSource and getLLMResponse, unlimited until the scrape command sets them
+var limits = &rateLimits{}
+
+// newRateLimits takes fetch rates in requests per second and llm rates per minute, where zero
+// means unlimited
+func newRateLimits(fetchRate, hostRate, llmRequestsPerMinute, llmTokensPerMinute float64) *rateLimits {
+	return &rateLimits{
+		fetch:       newTokenBucket(fetchRate, 1),
+		hostRate:    hostRate,
+		hosts:       map[string]*tokenBucket{},
+		llmRequests: newTokenBucket(llmRequestsPerMinute/60, 1),
+		llmTokens:   newTokenBucket(llmTokensPerMinute/60, llmTokensPerMinute),
+	}
+}
+
+func (l *rateLimits) waitForFetch(ctx context.Context, pageURL string) error {
+	err := l.fetch.Wait(ctx, 1)
+	if err != nil {
+		return err
+	}
+
+	return l.hostBucket(pageURL).Wait(ctx, 1)
+}
+
+func (l *rateLimits) waitForLLM(ctx context.Context, tokens int) error {
+	err := l.llmRequests.Wait(ctx, 1)
+	if err != nil {
+		return err
+	}
+
+	return l.llmTokens.Wait(ctx, float64(tokens))
+}
+
+func (l *rateLimits) hostBucket(pageURL string) *tokenBucket {
+	if l.hostRate <= 0 {
+		return nil
+	}
+
+	group := hostGroup(pageURL)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.hosts[group] == nil {
+		l.hosts[group] = newTokenBucket(l.hostRate, 1)
+	}
+
+	return l.hosts[group]
+}
+
+// hostGroup reduces a url to its last two domain labels so pelosi.house.gov and
+// jeffries.house.gov are limited together
+func hostGroup(pageURL string) string {
+	parsed, err := url.Parse(pageURL)
+	if err != nil {
+		return pageURL
+	}
+
+	labels := strings.Split(strings.ToLower(parsed.Hostname()), ".")
+	if len(labels) > 2 {
+		labels = labels[len(labels)-2:]
+	}
+
+	return strings.Join(labels, ".")
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestHostGroup(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"https://pelosi.house.gov", "house.gov"},
+		{"https://www.sanders.senate.gov/contact/", "senate.gov"},
+		{"https://example.com", "example.com"},
+	}
+
+	for _, tc := range testCases {
+		result := hostGroup(tc.input)
+		if result != tc.expected {
+			t.Errorf("hostGroup(%q) = %q, expected %q", tc.input, result, tc.expected)
+		}
+	}
+}
+
+func TestTokenBucketWaits(t *testing.T) {
+	bucket := newTokenBucket(20, 1)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := bucket.Wait(context.Background(), 1); err != nil {
+			t.Fatalf("Wait() error = %v", err)
+		}
+	}
+
+	// the first token is available immediately, the next two take 50ms each
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("expected 3 waits at 20/s to take about 100ms, took %v", elapsed)
+	}
+
+	var unlimited *tokenBucket
+	if err := unlimited.Wait(context.Background(), 1000); err != nil {
+		t.Errorf("expected a nil bucket not to wait, got %v", err)
+	}
+}
@@ -1,9 +1,9 @@
 package main
 
 import (
-	"io"
+	"context"
+	"fmt"
 	"log"
-	"net/http"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -26,36 +26,39 @@ type Legislator struct {
 	} `yaml:"terms"`
 }
 
-// listRepURLs returns a map of bioguide IDs to website urls
-func listRepURLs() map[string]string {
-	url := "https://raw.githubusercontent.com/unitedstates/congress-legislators/main/legislators-current.yaml"
+// CurrentLegislator is the part of a current legislator's latest term that we scrape by
+type CurrentLegislator struct {
+	Bioguide string
+	URL      string
+	State    string
+	// rep or sen
+	Chamber string
+}
 
-	websiteURLs := map[string]string{}
+// where the list of current legislators comes from
+var legislatorsURL = "https://raw.githubusercontent.com/unitedstates/congress-legislators/main/legislators-current.yaml"
 
-	// Download the YAML file
-	resp, err := http.Get(url)
+// listCurrentLegislators returns every current representative and senator, or an error if the
+// legislator list can't be downloaded or parsed. It's fetched like any other page, so offline runs
+// use the cached copy
+func listCurrentLegislators(ctx context.Context) ([]CurrentLegislator, error) {
+	body, err := getPageSource(ctx, legislatorsURL)
 	if err != nil {
-		log.Printf("Error downloading file: %v\n", err)
-		return websiteURLs
-	}
-	defer resp.Body.Close()
-
-	// Read the response body
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Printf("Error reading response body: %v\n", err)
-		return websiteURLs
+		if pageCache != nil && pageCache.Offline {
+			return nil, fmt.Errorf("the legislator list isn't cached, run once without -offline first: %v", err)
+		}
+		return nil, fmt.Errorf("error downloading legislator list: %v", err)
 	}
 
 	// Parse the YAML
 	var legislators []Legislator
-	err = yaml.Unmarshal(body, &legislators)
+	err = yaml.Unmarshal([]byte(body), &legislators)
 	if err != nil {
-		log.Printf("Error parsing YAML: %v\n", err)
-		return websiteURLs
+		return nil, fmt.Errorf("error parsing legislator list: %v", err)
 	}
 
 	// Extract URLs of current representatives
+	var current []CurrentLegislator
 	for _, legislator := range legislators {
 		if len(legislator.Terms) > 0 {
 			latestTerm := legislator.Terms[len(legislator.Terms)-1]
@@ -69,10 +72,15 @@ func listRepURLs() map[string]string {
 				continue
 			}
 			if latestTerm.Type == "rep" || latestTerm.Type == "sen" {
-				websiteURLs[legislator.ID.Bioguide] = latestTerm.URL
+				current = append(current, CurrentLegislator{
+					Bioguide: legislator.ID.Bioguide,
+					URL:      latestTerm.URL,
+					State:    latestTerm.State,
+					Chamber:  latestTerm.Type,
+				})
 			}
 		}
 	}
 
-	return websiteURLs
+	return current, nil
 }
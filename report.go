@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const DefaultReportFile = "scrape-report"
+
+// StatusResumed marks legislators whose results came from the journal of an earlier, interrupted
+// run rather than being scraped again
+const StatusResumed = "resumed"
+
+// StatusSkipped marks legislators the run never got to, because it was cancelled, ran out of time
+// or hit the spending cap
+const StatusSkipped = "skipped"
+
+// LegislatorReport is how scraping one legislator went
+type LegislatorReport struct {
+	Bioguide        string     `json:"bioguide"`
+	URL             string     `json:"url"`
+	Status          string     `json:"status"`
+	HTTPStatus      int        `json:"http_status,omitempty"`
+	URLsTried       []string   `json:"urls_tried,omitempty"`
+	Offices         int        `json:"offices"`
+	Unchanged       bool       `json:"unchanged,omitempty"`
+	KeptPrevious    bool       `json:"kept_previous,omitempty"`
+	Error           string     `json:"error,omitempty"`
+	Usage           TokenUsage `json:"usage"`
+	CostUSD         float64    `json:"cost_usd"`
+	DurationSeconds float64    `json:"duration_seconds"`
+}
+
+// RunReport summarizes a whole scrape run so failures can be triaged without reading the logs
+type RunReport struct {
+	StartedAt   time.Time          `json:"started_at"`
+	FinishedAt  time.Time          `json:"finished_at"`
+	Interrupted bool               `json:"interrupted,omitempty"`
+	Counts      map[string]int     `json:"counts"`
+	Usage       TokenUsage         `json:"usage"`
+	CostUSD     float64            `json:"cost_usd"`
+	Legislators []LegislatorReport `json:"legislators"`
+}
+
+func newLegislatorReport(bioguide, url string, result addressResult, err error, duration time.Duration) LegislatorReport {
+	report := LegislatorReport{
+		Bioguide:        bioguide,
+		URL:             url,
+		Status:          result.Status,
+		HTTPStatus:      result.HTTPStatus,
+		URLsTried:       result.URLsTried,
+		Offices:         len(result.Offices),
+		Unchanged:       result.Unchanged,
+		Usage:           result.Usage,
+		CostUSD:         spending.costOf(result.Usage),
+		DurationSeconds: duration.Round(time.Millisecond).Seconds(),
+	}
+	if err != nil {
+		report.Error = err.Error()
+	}
+
+	return report
+}
+
+// addSkipped adds a skipped entry for every legislator in urls the report doesn't have yet, so the
+// report lists everyone the run was meant to scrape
+func (r *RunReport) addSkipped(urls map[string]string, reason string) {
+	reported := map[string]bool{}
+	for _, leg := range r.Legislators {
+		reported[leg.Bioguide] = true
+	}
+
+	for bioguide, url := range urls {
+		if !reported[bioguide] {
+			r.Legislators = append(r.Legislators, LegislatorReport{Bioguide: bioguide, URL: url, Status: StatusSkipped, Error: reason})
+		}
+	}
+}
+
+// finish fills in the totals and sorts legislators by bioguide for consistent diffs
+func (r *RunReport) finish(fellBack []string) {
+	r.FinishedAt = time.Now()
+
+	kept := map[string]bool{}
+	for _, bioguide := range fellBack {
+		kept[bioguide] = true
+	}
+
+	r.Counts = map[string]int{}
+	r.Usage = TokenUsage{}
+	for i := range r.Legislators {
+		r.Legislators[i].KeptPrevious = kept[r.Legislators[i].Bioguide]
+		r.Counts[r.Legislators[i].Status]++
+		r.Usage.Add(r.Legislators[i].Usage)
+	}
+	r.CostUSD = spending.costOf(r.Usage)
+
+	sort.Slice(r.Legislators, func(i, j int) bool {
+		return strings.ToLower(r.Legislators[i].Bioguide) < strings.ToLower(r.Legislators[j].Bioguide)
+	})
+}
+
+// write saves the report as both json for tools and markdown for people, at path with .json and
+// .md extensions
+func (r *RunReport) write(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling run report: %v", err)
+	}
+	err = os.WriteFile(path+".json", data, 0644)
+	if err != nil {
+		return fmt.Errorf("error writing run report: %v", err)
+	}
+
+	err = os.WriteFile(path+".md", []byte(r.markdown()), 0644)
+	if err != nil {
+		return fmt.Errorf("error writing run report: %v", err)
+	}
+
+	return nil
+}
+
+func (r *RunReport) markdown() string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "# Scrape report\n\n")
+	fmt.Fprintf(&sb, "Started %s, took %s", r.StartedAt.Format(time.RFC3339), r.FinishedAt.Sub(r.StartedAt).Round(time.Second))
+	if r.Interrupted {
+		fmt.Fprintf(&sb, " (interrupted)")
+	}
+	fmt.Fprintf(&sb, "\n\n")
+
+	statuses := make([]string, 0, len(r.Counts))
+	for status := range r.Counts {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+	fmt.Fprintf(&sb, "| status | legislators |\n|---|---|\n")
+	for _, status := range statuses {
+		fmt.Fprintf(&sb, "| %s | %d |\n", status, r.Counts[status])
+	}
+	fmt.Fprintf(&sb, "\n%d llm requests, %d prompt tokens, %d completion tokens, about $%.4f\n", r.Usage.Requests, r.Usage.PromptTokens, r.Usage.CompletionTokens, r.CostUSD)
+
+	// only the legislators that need looking at, everything is in the json version
+	fmt.Fprintf(&sb, "\n## Needs attention\n\n")
+	fmt.Fprintf(&sb, "| bioguide | status | http | offices | kept previous | urls tried | error |\n|---|---|---|---|---|---|---|\n")
+	for _, leg := range r.Legislators {
+		if leg.Status == StatusOK || leg.Status == StatusResumed {
+			continue
+		}
+		fmt.Fprintf(&sb, "| %s | %s | %d | %d | %t | %s | %s |\n", leg.Bioguide, leg.Status, leg.HTTPStatus, leg.Offices, leg.KeptPrevious,
+			strings.Join(leg.URLsTried, "<br>"), strings.NewReplacer("|", "\\|", "\n", " ").Replace(leg.Error))
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunReport(t *testing.T) {
+	report := &RunReport{StartedAt: time.Now(), Interrupted: true}
+	report.Legislators = []LegislatorReport{
+		newLegislatorReport("B000002", "https://b.house.gov", addressResult{Status: StatusOK, HTTPStatus: 200, Offices: []OfficeInfo{{City: "Springfield"}}}, nil, time.Second),
+		newLegislatorReport("A000001", "https://a.house.gov", addressResult{Status: StatusFetchError, HTTPStatus: 404, URLsTried: []string{"https://a.house.gov"}}, &statusError{URL: "https://a.house.gov", StatusCode: 404}, time.Second),
+	}
+	report.addSkipped(map[string]string{"A000001": "https://a.house.gov", "B000002": "https://b.house.gov", "C000003": "https://c.house.gov"}, "not reached, scrape stopped early: context canceled")
+	report.finish([]string{"A000001"})
+
+	path := filepath.Join(t.TempDir(), "report")
+	err := report.write(path)
+	if err != nil {
+		t.Fatalf("write() error = %v", err)
+	}
+
+	data, err := os.ReadFile(path + ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written RunReport
+	err = json.Unmarshal(data, &written)
+	if err != nil {
+		t.Fatalf("report json doesn't parse: %v", err)
+	}
+	if len(written.Legislators) != 3 {
+		t.Fatalf("expected every legislator in the report, got %+v", written.Legislators)
+	}
+	expected := []struct {
+		bioguide string
+		status   string
+		kept     bool
+	}{
+		{"A000001", StatusFetchError, true},
+		{"B000002", StatusOK, false},
+		{"C000003", StatusSkipped, false},
+	}
+	for i, leg := range written.Legislators {
+		if leg.Bioguide != expected[i].bioguide || leg.Status != expected[i].status || leg.KeptPrevious != expected[i].kept {
+			t.Errorf("legislator %d = %+v, expected %+v", i, leg, expected[i])
+		}
+	}
+	if written.Counts[StatusOK] != 1 || written.Counts[StatusFetchError] != 1 || written.Counts[StatusSkipped] != 1 || !written.Interrupted {
+		t.Errorf("unexpected totals %+v, interrupted %t", written.Counts, written.Interrupted)
+	}
+
+	markdown, err := os.ReadFile(path + ".md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"(interrupted)",
+		"| skipped | 1 |",
+		"| A000001 | fetch-error | 404 | 0 | true | https://a.house.gov | status code 404 for url https://a.house.gov |",
+		"| C000003 | skipped | 0 | 0 | false |  | not reached, scrape stopped early: context canceled |",
+	} {
+		if !strings.Contains(string(markdown), want) {
+			t.Errorf("expected the markdown report to contain %q, got:\n%s", want, markdown)
+		}
+	}
+	if strings.Contains(string(markdown), "| B000002 |") {
+		t.Errorf("expected legislators that went fine to be left out of the markdown report")
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how many times a request is attempted and how long we wait between
+// attempts. Delays double each attempt up to MaxDelay, with jitter so parallel workers don't all
+// retry at once
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// if a server asks us to wait longer than this we give up instead
+const maxRetryAfter = 5 * time.Minute
+
+var DefaultFetchRetryPolicy = RetryPolicy{MaxAttempts: 3, BaseDelay: 2 * time.Second, MaxDelay: 30 * time.Second}
+var DefaultLLMRetryPolicy = RetryPolicy{MaxAttempts: 5, BaseDelay: 2 * time.Second, MaxDelay: time.Minute}
+
+// the client used for fetching member sites and the legislator list
+var pageClient = &http.Client{}
+
+// backoff returns the delay before the attempt after the given one, somewhere between half and
+// all of the exponential delay
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay << (attempt - 1)
+	if delay > p.MaxDelay || delay <= 0 {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// retryTransport retries requests that fail with network errors, 429s or 5xx responses, and
+// honors Retry-After when the server sends it. Wrapping the transport lets the same policy apply
+// to our own fetches and to the openai client
+type retryTransport struct {
+	// shows up in the log so we can tell site fetches from llm calls
+	name   string
+	policy RetryPolicy
+	base   http.RoundTripper
+}
+
+func newRetryClient(name string, policy RetryPolicy) *http.Client {
+	return &http.Client{Transport: &retryTransport{name: name, policy: policy, base: http.DefaultTransport}}
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		attemptReq := req
+		if attempt > 1 && req.Body != nil {
+			if req.GetBody == nil {
+				return nil, fmt.Errorf("can't retry %s, request body can't be replayed", req.URL)
+			}
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			attemptReq = req.Clone(req.Context())
+			attemptReq.Body = body
+		}
+
+		res, err := t.base.RoundTrip(attemptReq)
+
+		reason, retryAfter := retryReason(res, err)
+		if reason == "" || attempt >= t.policy.MaxAttempts || retryAfter > maxRetryAfter {
+			if reason != "" && attempt > 1 {
+				log.Printf("%s: giving up on %s after %d attempts (%s)", t.name, req.URL, attempt, reason)
+			}
+			return res, err
+		}
+
+		delay := t.policy.backoff(attempt)
+		if retryAfter > delay {
+			delay = retryAfter
+		}
+		log.Printf("%s: attempt %d/%d for %s failed (%s), retrying in %s", t.name, attempt, t.policy.MaxAttempts, req.URL, reason, delay.Round(time.Millisecond))
+
+		if res != nil {
+			io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+}
+
+// retryReason describes why a response should be retried, or returns an empty string if it
+// shouldn't be, along with any delay the server asked for
+func retryReason(res *http.Response, err error) (string, time.Duration) {
+	if err != nil {
+		return err.Error(), 0
+	}
+	if res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500 {
+		return fmt.Sprintf("status code %d", res.StatusCode), parseRetryAfter(res.Header.Get("Retry-After"), time.Now())
+	}
+
+	return "", 0
+}
+
+// parseRetryAfter handles both forms of the Retry-After header, a number of seconds or an http date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+
+	return 0
+}
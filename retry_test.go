@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRetryTransport(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/flaky":
+			if requests < 3 {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := newRetryClient("test", RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond})
+
+	res, err := client.Get(server.URL + "/flaky")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || requests != 3 {
+		t.Errorf("expected success on the third attempt, got status %d after %d requests", res.StatusCode, requests)
+	}
+
+	requests = 0
+	res, err = client.Get(server.URL + "/missing")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound || requests != 1 {
+		t.Errorf("expected a 404 not to be retried, got status %d after %d requests", res.StatusCode, requests)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 11, 6, 12, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		input    string
+		expected time.Duration
+	}{
+		{"", 0},
+		{"30", 30 * time.Second},
+		{"Wed, 06 Nov 2024 12:01:00 GMT", time.Minute},
+		{"Wed, 06 Nov 2024 11:00:00 GMT", 0},
+		{"soon", 0},
+	}
+
+	for _, tc := range testCases {
+		result := parseRetryAfter(tc.input, now)
+		if result != tc.expected {
+			t.Errorf("parseRetryAfter(%q) = %v, expected %v", tc.input, result, tc.expected)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -14,23 +15,185 @@ import (
 	"sync"
 	"time"
 
-	"github.com/sashabaranov/go-openai"
-	"github.com/sashabaranov/go-openai/jsonschema"
 	"jaytaylor.com/html2text"
 )
 
 const ADDRESS_PROMPT = `please find all office addresses within this content, returning them in json formatting as plain text without any backticks or formatting indicators. Include the fields: address, city, state, zip, phone.
 If a fax number is listed, also include it in a fax field.
 If the address includes a suite or room number, include it in a suite field. Do not include the suite or room information in the address field. If there is no suite or room, omit the suite field.
-if the address includes a building, include it in a building field. Do not include the building information in the address field. If there is no building, omit the building field.`
+if the address includes a building, include it in a building field. Do not include the building information in the address field. If there is no building, omit the building field.
+If the office's opening hours are listed, include the days and times in an hours field. If there are no hours, omit the hours field.`
 
-const LOCATIONS_PROMPT = `please return only the most likely url on this page that would list office locations without any other text`
+const LOCATIONS_PROMPT = `here are the links on a page, one per line as the link text followed by the url. please return the most likely url that would list office locations, or an empty url if there isn't one`
 
-func scrapeAllURLs() error {
-	bioguideToURLs := listRepURLs()
+// default deadlines for each page fetch and each llm request, including retries
+const (
+	DefaultFetchTimeout = 2 * time.Minute
+	DefaultLLMTimeout   = 5 * time.Minute
+)
+
+var (
+	fetchTimeout = DefaultFetchTimeout
+	llmTimeout   = DefaultLLMTimeout
+)
+
+// where results go when an interrupted run doesn't have enough to replace offices.json
+const PartialOfficesFile = "offices.partial.json"
+
+// there are 535 members of congress, so anything well under that means the legislator list or
+// the scrape went wrong and we shouldn't overwrite good data with it
+const DefaultMinLegislators = 500
+
+// scrapeOptions holds the settings for a full scrape run
+type scrapeOptions struct {
+	// keep previous entries for legislators whose scrape fails or comes back empty
+	Merge bool
+	// the fewest legislators we'll accept before refusing to write offices.json
+	MinLegislators int
+	// re-extract every page even if its content hasn't changed since the last run
+	Force bool
+	// skip legislators already finished in the journal of an interrupted run
+	Resume bool
+	// where to write the run report, without an extension. Empty skips the report
+	ReportPath string
+	// only scrape some legislators, leaving everyone else's entries alone
+	Filter legislatorFilter
+	// how many legislators to scrape at once
+	Workers int
+	Find    findOptions
+}
+
+// scrapeAllURLs scrapes every current legislator and writes offices.json. With merge set, any
+// legislator whose scrape fails or comes back empty keeps their entry from the existing file
+func scrapeAllURLs(ctx context.Context, opts scrapeOptions) error {
+	report := &RunReport{StartedAt: time.Now()}
+
+	legislators, err := listCurrentLegislators(ctx)
+	if err != nil {
+		return err
+	}
+	if len(legislators) < opts.MinLegislators {
+		return fmt.Errorf("only %d legislators resolved, expected at least %d", len(legislators), opts.MinLegislators)
+	}
+	currentURLs := map[string]string{}
+	for _, legislator := range legislators {
+		currentURLs[legislator.Bioguide] = legislator.URL
+	}
+
+	// the previous run's results let us skip unchanged pages and fall back on failures
+	previous, err := readOfficeList(OfficesFile)
+	if err != nil {
+		if opts.Merge {
+			return err
+		}
+		if opts.Filter.active() {
+			return fmt.Errorf("a filtered scrape needs the existing %s to merge into: %v", OfficesFile, err)
+		}
+		log.Printf("no previous results to compare against: %v", err)
+	}
+
+	bioguideToURLs := opts.Filter.apply(legislators, previous)
 	log.Printf("got %d urls to scrape", len(bioguideToURLs))
+	previousByBioguide := previousForScrape(previous, opts.Force)
+
+	journalPath := opts.Filter.journalPath()
+	journal, completed, err := openJournal(journalPath, opts.Resume, opts.Force)
+	if err != nil {
+		return err
+	}
+	defer journal.Close()
+
+	// legislators finished earlier in this run don't need doing again
+	toScrape := map[string]string{}
+	for bioguide, url := range bioguideToURLs {
+		toScrape[bioguide] = url
+	}
+	var resumed []OfficeList
+	for _, leg := range completed {
+		if _, ok := toScrape[leg.Bioguide]; ok {
+			delete(toScrape, leg.Bioguide)
+			resumed = append(resumed, leg)
+			report.Legislators = append(report.Legislators, LegislatorReport{Bioguide: leg.Bioguide, URL: leg.URL, Status: StatusResumed, Offices: len(leg.Offices)})
+		}
+	}
+	if opts.Resume {
+		log.Printf("resuming with %d legislators already done, %d to go", len(resumed), len(toScrape))
+	}
+
+	results, failures, legislatorReports := processURLs(ctx, toScrape, previousByBioguide, journal, opts.Workers, opts.Find)
+	results = append(resumed, results...)
+	report.Legislators = append(report.Legislators, legislatorReports...)
+
+	// on ctrl-c, the overall timeout or hitting the spending cap we still save everything we got so far.
+	// The cap only cuts a run short when it stopped some legislators from being started, the last
+	// one to finish often goes over it
+	started := map[string]bool{}
+	for _, legislatorReport := range legislatorReports {
+		started[legislatorReport.Bioguide] = true
+	}
+	unstarted := 0
+	for bioguide := range toScrape {
+		if !started[bioguide] {
+			unstarted++
+		}
+	}
+	interrupted := ctx.Err() != nil || (spending.exhausted() && unstarted > 0)
+	if interrupted {
+		reason := ctx.Err()
+		if reason == nil {
+			reason = fmt.Errorf("spending cap reached")
+		}
+		log.Printf("scrape stopped early (%v) with %d of %d legislators done", reason, len(results), len(bioguideToURLs))
+		// anything cut off by the interruption didn't really fail
+		cutOff := map[string]bool{}
+		for bioguide, err := range failures {
+			if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+				delete(failures, bioguide)
+				cutOff[bioguide] = true
+			}
+		}
+		for i := range report.Legislators {
+			if cutOff[report.Legislators[i].Bioguide] {
+				report.Legislators[i].Status = StatusSkipped
+			}
+		}
+		report.addSkipped(bioguideToURLs, fmt.Sprintf("not reached, scrape stopped early: %v", reason))
+	}
+
+	var fellBack []string
+	if opts.Merge {
+		results, fellBack = mergeOfficeLists(previous, results, failures, time.Now())
+		sort.Strings(fellBack)
+		for _, bioguide := range fellBack {
+			reason := "no offices found"
+			if failures[bioguide] != nil {
+				reason = failures[bioguide].Error()
+			}
+			log.Printf("kept previous offices for %s: %s", bioguide, reason)
+		}
+		log.Printf("%d legislators fell back to previous results", len(fellBack))
+	}
+
+	// legislators we didn't get to or that weren't part of a filtered run keep their entries
+	if interrupted || opts.Filter.active() {
+		results = keepUnscraped(previous, results, currentURLs)
+	}
+
+	report.Interrupted = interrupted
+	report.finish(fellBack)
+	if opts.ReportPath != "" {
+		err = report.write(opts.ReportPath)
+		if err != nil {
+			log.Printf("couldn't write the run report: %v", err)
+		} else {
+			log.Printf("wrote run report to %s.json and %s.md", opts.ReportPath, opts.ReportPath)
+		}
+	}
+
+	if geocoder != nil {
+		log.Printf("geocoded %d offices", geocoder.geocodeOfficeLists(results))
+	}
 
-	results := processURLs(bioguideToURLs)
 	// sort legislators by bioguide for consistent diffs
 	sort.Slice(results, func(i, j int) bool {
 		return strings.ToLower(results[i].Bioguide) < strings.ToLower(results[j].Bioguide)
@@ -42,128 +205,320 @@ func scrapeAllURLs() error {
 		})
 	}
 
-	file, err := os.Create("offices.json")
+	// legislators with no offices don't count, or a run where every extraction came back empty
+	// would replace everything with nothing
+	withOffices := countWithOffices(results)
+	if withOffices < opts.MinLegislators {
+		if interrupted {
+			err = writeOfficeList(PartialOfficesFile, results)
+			if err != nil {
+				return err
+			}
+			return fmt.Errorf("scrape interrupted with only %d legislators, saved them to %s", withOffices, PartialOfficesFile)
+		}
+		return fmt.Errorf("only %d legislators have offices, expected at least %d; not writing %s", withOffices, opts.MinLegislators, OfficesFile)
+	}
+
+	err = writeOfficeList(OfficesFile, results)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 
-	encoder := json.NewEncoder(file)
-	err = encoder.Encode(results)
+	if interrupted {
+		return fmt.Errorf("scrape interrupted, saved %d new results to %s", len(results), OfficesFile)
+	}
+
+	// the run is complete so there's nothing left to resume
+	journal.Close()
+	err = os.Remove(journalPath)
 	if err != nil {
-		return err
+		log.Printf("couldn't remove the journal: %v", err)
 	}
 
 	return nil
 }
 
-func processURLs(urls map[string]string) []OfficeList {
+// previousForScrape indexes the previous results by bioguide for processURLs. Forcing a new
+// extraction drops the content hashes so nothing counts as unchanged, but keeps the pages the
+// offices were found on last time
+func previousForScrape(previous []OfficeList, force bool) map[string]OfficeList {
+	byBioguide := map[string]OfficeList{}
+	for _, leg := range previous {
+		if force {
+			leg.ContentHash = ""
+		}
+		byBioguide[leg.Bioguide] = leg
+	}
+
+	return byBioguide
+}
+
+func countWithOffices(results []OfficeList) int {
+	count := 0
+	for _, leg := range results {
+		if len(leg.Offices) > 0 {
+			count++
+		}
+	}
+
+	return count
+}
+
+// processURLs scrapes each bioguide's url, returning the successful results along with the errors
+// for any that failed and a report for every legislator attempted. Entries in previous let unchanged pages skip extraction, and each success
+// is recorded in the journal as soon as it's done
+func processURLs(ctx context.Context, urls map[string]string, previous map[string]OfficeList, journal *scrapeJournal, workers int, opts findOptions) ([]OfficeList, map[string]error, []LegislatorReport) {
 	var results []OfficeList
+	var reports []LegislatorReport
+	failures := map[string]error{}
 	var mutex sync.Mutex
 	var wg sync.WaitGroup
 
-	// process urls no more than 5 at a time, started 1s apart at least
-	// in an attempt to not make rate limiting gods angry
-	semaphore := make(chan struct{}, 5)
-	rateLimiter := time.Tick(time.Second)
+	// process urls no more than workers at a time. Page fetches and llm calls are rate limited
+	// separately in an attempt to not make rate limiting gods angry
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	semaphore := make(chan struct{}, workers)
 
 	for bioguide, url := range urls {
 		wg.Add(1)
 		go func(bg string, u string) {
 			defer wg.Done()
 			semaphore <- struct{}{}
-			<-rateLimiter
 			defer func() { <-semaphore }()
 
-			offices, err := findAddresses(u, false)
+			// don't start anything new once the run is cancelled, out of time or out of money
+			if ctx.Err() != nil || spending.exhausted() {
+				return
+			}
+
+			var prev *OfficeList
+			if leg, ok := previous[bg]; ok {
+				prev = &leg
+			}
+
+			start := time.Now()
+			result, err := findAddresses(ctx, u, prev, opts)
+			report := newLegislatorReport(bg, u, result, err, time.Since(start))
 			if err != nil {
 				log.Printf("Error processing %s: %v", u, err)
+				mutex.Lock()
+				failures[bg] = err
+				reports = append(reports, report)
+				mutex.Unlock()
 				return
 			}
 
+			leg := OfficeList{Bioguide: bg, URL: u, Offices: result.Offices, ContentHash: result.ContentHash, SourceURLs: result.SourceURLs}
+			err = journal.Record(leg)
+			if err != nil {
+				log.Printf("Error recording %s in the journal: %v", bg, err)
+			}
+
 			mutex.Lock()
-			results = append(results, OfficeList{Bioguide: bg, URL: u, Offices: offices})
+			results = append(results, leg)
+			reports = append(reports, report)
 			mutex.Unlock()
 		}(bioguide, url)
 	}
 
 	wg.Wait()
-	return results
+	return results, failures, reports
 }
 
-func scrapeOne(scrapeURL string, debug bool) error {
-	parsedURL, err := url.Parse(scrapeURL)
+// scrapeOne scrapes a single legislator and updates their entry in offices.json, adding one if
+// they're a current legislator without an entry yet. The legislator can be picked by bioguide, by
+// any url on their site, or by both to scrape a specific page for a known legislator
+func scrapeOne(ctx context.Context, scrapeURL, bioguide string, opts findOptions) error {
+	if scrapeURL != "" && !strings.Contains(scrapeURL, "://") {
+		scrapeURL = "https://" + scrapeURL
+	}
+	if scrapeURL != "" {
+		_, err := url.ParseRequestURI(scrapeURL)
+		if err != nil {
+			return fmt.Errorf("couldn't parse url: %s", err)
+		}
+	}
+
+	// match by bioguide when we have one, otherwise by site so urls with paths, www. or a
+	// different scheme still find the right legislator
+	matches := func(legBioguide, legURL string) bool {
+		if bioguide != "" {
+			return strings.EqualFold(legBioguide, bioguide)
+		}
+		return normalizeHost(legURL) == normalizeHost(scrapeURL)
+	}
+
+	officeList, err := readOfficeList(OfficesFile)
 	if err != nil {
-		return fmt.Errorf("couldn't parse url: %s", err)
+		return err
 	}
 
-	addresses, err := findAddresses(scrapeURL, debug)
+	index := -1
+	var entry OfficeList
+	for i, leg := range officeList {
+		if matches(leg.Bioguide, leg.URL) {
+			index = i
+			entry = leg
+			break
+		}
+	}
+	if index < 0 {
+		// most likely a new member who hasn't been scraped before
+		legislators, err := listCurrentLegislators(ctx)
+		if err != nil {
+			return err
+		}
+		for _, legislator := range legislators {
+			if matches(legislator.Bioguide, legislator.URL) {
+				entry = OfficeList{Bioguide: legislator.Bioguide, URL: legislator.URL}
+				break
+			}
+		}
+		if entry.Bioguide == "" {
+			return fmt.Errorf("couldn't find a current legislator for %s%s", bioguide, scrapeURL)
+		}
+		log.Printf("%s isn't in %s yet, adding them", entry.Bioguide, OfficesFile)
+	}
+
+	// always extract again, but from the pages the offices were found on last time unless we were
+	// given a page to use
+	var previous *OfficeList
+	if scrapeURL == "" {
+		scrapeURL = entry.URL
+		previous = &OfficeList{Bioguide: entry.Bioguide, SourceURLs: entry.SourceURLs}
+	} else if normalizeHost(scrapeURL) != normalizeHost(entry.URL) {
+		log.Printf("scraping %s for %s even though their site is %s", scrapeURL, entry.Bioguide, entry.URL)
+	}
+
+	result, err := findAddresses(ctx, scrapeURL, previous, opts)
 	if err != nil {
 		return fmt.Errorf("error finding addresses for %s: %v", scrapeURL, err)
 	}
-	if debug {
-		log.Printf("found addresses: %+v", addresses)
+	if opts.Debug {
+		log.Printf("found addresses: %+v", result.Offices)
 	}
 
-	officesData, err := os.ReadFile("offices.json")
-	if err != nil {
-		return fmt.Errorf("error reading offices.json: %v", err)
+	entry.Offices = result.Offices
+	if geocoder != nil {
+		log.Printf("geocoded %d offices", geocoder.geocodeOffices(entry.Offices))
+	}
+	entry.SourceURLs = result.SourceURLs
+	entry.Stale = nil
+	// full scrapes compare against the hash of the legislator's main page or remembered pages, so
+	// a hash for some other page would never match
+	entry.ContentHash = ""
+	if normalizePageURL(scrapeURL) == normalizePageURL(entry.URL) {
+		entry.ContentHash = result.ContentHash
 	}
 
-	var officeList []OfficeList
-	err = json.Unmarshal(officesData, &officeList)
+	if index >= 0 {
+		officeList[index] = entry
+	} else {
+		officeList = append(officeList, entry)
+		sort.Slice(officeList, func(i, j int) bool {
+			return strings.ToLower(officeList[i].Bioguide) < strings.ToLower(officeList[j].Bioguide)
+		})
+	}
+
+	err = writeOfficeList(OfficesFile, officeList)
 	if err != nil {
-		return fmt.Errorf("error parsing offices.json: %v", err)
+		return err
 	}
 
-	domain := fmt.Sprintf("%s://%s", parsedURL.Scheme, parsedURL.Host)
+	log.Printf("updated %s", entry.Bioguide)
 
-	bioguide := ""
-	updated := false
-	for i, office := range officeList {
-		if office.URL == domain {
-			officeList[i].Offices = addresses
-			bioguide = office.Bioguide
-			updated = true
-			break
-		}
+	return nil
+}
+
+// normalizeHost reduces a url to a lowercase host without www. so different ways of writing the
+// same site compare equal
+func normalizeHost(rawURL string) string {
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "https://" + rawURL
 	}
-	if !updated {
-		return fmt.Errorf("couldn't find that url to update in the office list")
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
 	}
 
-	updatedData, err := json.MarshalIndent(officeList, "", "  ")
+	return strings.TrimPrefix(strings.ToLower(parsed.Hostname()), "www.")
+}
+
+// normalizePageURL is normalizeHost plus the path, ignoring any trailing slash
+func normalizePageURL(rawURL string) string {
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "https://" + rawURL
+	}
+	parsed, err := url.Parse(rawURL)
 	if err != nil {
-		return fmt.Errorf("error marshaling updated office list: %v", err)
+		return ""
 	}
 
-	err = os.WriteFile("offices.json", updatedData, 0644)
-	if err != nil {
-		return fmt.Errorf("error writing updated offices.json: %v", err)
+	return normalizeHost(rawURL) + strings.TrimRight(parsed.EscapedPath(), "/")
+}
+
+// statusError is returned when a page fetch gets something other than a 200
+type statusError struct {
+	URL        string
+	StatusCode int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("status code %d for url %s", e.StatusCode, e.URL)
+}
+
+// httpStatus gets the status code a fetch ended with from its error: 200 for no error and 0
+// when we never got a response
+func httpStatus(err error) int {
+	if err == nil {
+		return http.StatusOK
 	}
 
-	log.Printf("updated %s", bioguide)
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode
+	}
 
-	return nil
+	return 0
 }
 
-func getPageSource(contentURL string) (string, error) {
+func getPageSource(ctx context.Context, contentURL string) (string, error) {
 	_, err := url.ParseRequestURI(contentURL)
 	if err != nil {
 		return "", err
 	}
 
-	res, err := http.Get(contentURL)
+	// the timeout covers any retries too
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	if pageCache != nil {
+		return pageCache.Get(ctx, contentURL)
+	}
+
+	err = limits.waitForFetch(ctx, contentURL)
 	if err != nil {
 		return "", err
 	}
 
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, contentURL, nil)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := pageClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
 	if res.StatusCode != 200 {
-		return "", fmt.Errorf("status code %d for url %s", res.StatusCode, contentURL)
+		return "", &statusError{URL: contentURL, StatusCode: res.StatusCode}
 	}
 
 	html, err := io.ReadAll(res.Body)
-	res.Body.Close()
 	if err != nil {
 		return "", err
 	}
@@ -171,153 +526,544 @@ func getPageSource(contentURL string) (string, error) {
 	return string(html), nil
 }
 
-func findAddresses(contentURL string, debug bool) ([]OfficeInfo, error) {
+// statuses for how scraping a legislator went, used in the run report
+const (
+	StatusOK          = "ok"
+	StatusFallbackURL = "fallback-url"
+	StatusEmpty       = "empty"
+	StatusFetchError  = "fetch-error"
+	StatusLLMError    = "llm-error"
+)
+
+// addressResult is what findAddresses learned about a legislator's site
+type addressResult struct {
+	Offices []OfficeInfo
+	// hash of the normalized text of the page we started from
+	ContentHash string
+	// the page hadn't changed since the previous run so its offices were reused without extraction
+	Unchanged bool
+	// the pages the offices were extracted from
+	SourceURLs []string
+
+	// one of the Status constants
+	Status string
+	// the status of the last page fetched, when we got one
+	HTTPStatus int
+	URLsTried  []string
+	Usage      TokenUsage
+}
+
+// keepHash reports whether the result is good enough that the next run can reuse it when the
+// page hasn't changed. Offices from a fallback should get another chance at a proper extraction,
+// and when they came from a locations page the hash isn't even of the page they came from
+func (r addressResult) keepHash(opts findOptions) bool {
+	if r.Unchanged {
+		return true
+	}
+
+	return r.Status == StatusOK && opts.Extractor != ExtractorHeuristic && !fromHeuristics(r.Offices)
+}
+
+// findOptions are the settings that control how a single site is extracted
+type findOptions struct {
+	Debug bool
+	// how to use schema.org structured data, one of StructuredFirst, StructuredCheck or StructuredOff
+	StructuredData string
+	// how to extract from page text, one of ExtractorLLM, ExtractorHeuristic or ExtractorCheck
+	Extractor string
+	// what to do with offices that can't be found in the page, one of VerifyFlag, VerifyDrop or VerifyOff
+	Verify string
+	// when to look for other office pages on the site, one of DiscoverFallback, DiscoverAlways or DiscoverOff
+	Discover string
+	// most candidate pages to fetch when discovering
+	DiscoverPages int
+	// longest page text in estimated tokens to send the llm at once, zero sends everything at once
+	ChunkTokens int
+	// cut pages down to the blocks with addresses and phone numbers before extraction
+	Prune bool
+	// log how much pruning cut from each page
+	DebugPrune bool
+}
+
+// findAddresses extracts the offices listed on a legislator's site. If previous is provided and
+// the page text hasn't changed since it was scraped, its offices are reused instead of asking the
+// llm again. When previous remembers which pages its offices came from, those are tried before
+// the main page. Pass a nil previous to always extract from the main page
+func findAddresses(ctx context.Context, contentURL string, previous *OfficeList, opts findOptions) (result addressResult, err error) {
 	log.Printf("finding for %s", contentURL)
-	var offices []OfficeInfo
 
-	html, err := getPageSource(contentURL)
+	var usage TokenUsage
+	ctx = withUsage(ctx, &usage)
+	defer func() {
+		result.Usage = usage
+		if !result.keepHash(opts) {
+			result.ContentHash = ""
+		}
+	}()
+
+	fetch := func(pageURL string) (string, error) {
+		result.URLsTried = append(result.URLsTried, pageURL)
+		return getPageSource(ctx, pageURL)
+	}
+
+	if previous != nil && hasRememberedPages(contentURL, previous.SourceURLs) {
+		found, err := findRememberedAddresses(ctx, previous, fetch, opts, &result)
+		if found || err != nil {
+			return result, err
+		}
+		log.Printf("remembered office pages for %s didn't work, starting over from %s", previous.Bioguide, contentURL)
+		result.HTTPStatus = 0
+	}
+
+	html, err := fetch(contentURL)
+	result.HTTPStatus = httpStatus(err)
 	if err != nil {
-		return offices, err
+		result.Status = StatusFetchError
+		return result, err
 	}
-	if debug {
+	if opts.Debug {
 		log.Printf("html fetched was: %s", html)
 	}
 
-	htmlText, err := html2text.FromString(string(html), html2text.Options{TextOnly: true})
+	htmlText, err := pageText(contentURL, html, opts)
 	if err != nil {
-		return offices, fmt.Errorf("can't parse html to string: %s", err)
+		result.Status = StatusFetchError
+		return result, err
 	}
-	if debug {
+	if opts.Debug {
 		log.Printf("reduced html to text: %s", htmlText)
 	}
 
-	addressResponse, err := getOpenAIResponse(ADDRESS_PROMPT, htmlText, true)
-	if err != nil {
-		return offices, err
+	// note this is the hash of the page we start from, so when discovery adds offices from other
+	// pages we're trusting that changes to them show up here too
+	result.ContentHash = contentHash(htmlText, opts)
+	if previous != nil && previous.ContentHash == result.ContentHash && len(previous.Offices) > 0 {
+		log.Printf("content unchanged for %s, reusing %d offices", contentURL, len(previous.Offices))
+		result.Offices = previous.Offices
+		result.SourceURLs = previous.SourceURLs
+		result.Unchanged = true
+		result.Status = StatusOK
+		return result, nil
 	}
 
-	offices, err = marshalOffliceList(addressResponse)
+	result.Offices, err = extractOffices(ctx, contentURL, html, htmlText, opts)
 	if err != nil {
-		return offices, err
+		result.Status = StatusLLMError
+		return result, err
+	}
+	result.Status = StatusOK
+	if len(result.Offices) > 0 {
+		result.SourceURLs = []string{contentURL}
 	}
 
-	if len(offices) == 0 {
+	if opts.Discover == DiscoverAlways || (opts.Discover == DiscoverFallback && len(result.Offices) == 0) {
+		discovered, sources, err := discoverOffices(ctx, contentURL, html, fetch, opts)
+		if err != nil && len(result.Offices) == 0 {
+			result.Status = StatusLLMError
+			return result, err
+		}
+		if len(discovered) > 0 {
+			if len(result.Offices) == 0 {
+				result.Status = StatusFallbackURL
+			}
+			result.Offices = dedupeOffices(append(result.Offices, discovered...))
+			result.SourceURLs = append(result.SourceURLs, sources...)
+		}
+	}
+
+	if len(result.Offices) == 0 && opts.Extractor != ExtractorHeuristic {
 		log.Printf("couldn't get office locations at %s", contentURL)
-		// see if we can get a better url
-		locationsURL, err := getOpenAIResponse(LOCATIONS_PROMPT, string(html), false)
+		// last resort, ask the llm for a better url
+		// the links are all the llm needs to pick from, and far smaller than the html
+		links := splitIntoChunks(pageLinksText(html), opts.ChunkTokens)[0]
+		if links == "" {
+			log.Printf("no links to look for locations on at %s", contentURL)
+			result.Status = StatusEmpty
+			return result, nil
+		}
+		locationsResponse, err := getLLMResponse(ctx, LOCATIONS_PROMPT, links, locationsResponseSchema)
 		if err != nil {
-			return offices, err
+			result.Status = StatusLLMError
+			return result, err
+		}
+		locationsURL, err := resolveLocationsURL(contentURL, locationsResponse)
+		if err != nil {
+			log.Printf("no usable locations url for %s: %v", contentURL, err)
+			result.Status = StatusEmpty
+			return result, nil
 		}
 
 		log.Printf("trying alternative for %s, %s", contentURL, locationsURL)
-		html, err = getPageSource(locationsURL)
+		html, err = fetch(locationsURL)
+		result.HTTPStatus = httpStatus(err)
 		if err != nil {
-			return offices, err
+			result.Status = StatusFetchError
+			return result, err
+		}
+
+		htmlText, err := pageText(locationsURL, html, opts)
+		if err != nil {
+			result.Status = StatusFetchError
+			return result, err
+		}
+
+		result.Offices, err = extractOffices(ctx, locationsURL, html, htmlText, opts)
+		if err != nil {
+			result.Status = StatusLLMError
+			return result, err
+		}
+		result.Status = StatusFallbackURL
+		if len(result.Offices) > 0 {
+			result.SourceURLs = []string{locationsURL}
+		}
+	}
+
+	if len(result.Offices) == 0 {
+		result.Status = StatusEmpty
+	}
+	return result, nil
+}
+
+// hasRememberedPages reports whether a legislator's offices came from somewhere other than their
+// main page last time, on the same site
+func hasRememberedPages(contentURL string, sourceURLs []string) bool {
+	if len(sourceURLs) == 0 {
+		return false
+	}
+	if len(sourceURLs) == 1 && normalizePageURL(sourceURLs[0]) == normalizePageURL(contentURL) {
+		return false
+	}
+	for _, source := range sourceURLs {
+		// a member whose site moved needs their pages found again
+		if normalizeHost(source) != normalizeHost(contentURL) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// findRememberedAddresses extracts offices from the pages they were found on last time. found is
+// false when none of those pages could be fetched or they had no offices, and the caller should
+// start over from the main page
+func findRememberedAddresses(ctx context.Context, previous *OfficeList, fetch func(string) (string, error), opts findOptions, result *addressResult) (found bool, err error) {
+	log.Printf("starting from remembered office pages for %s: %v", previous.Bioguide, previous.SourceURLs)
+
+	pages := fetchPages(ctx, previous.SourceURLs, fetch, opts)
+	if len(pages) == 0 {
+		return false, ctx.Err()
+	}
+	result.HTTPStatus = http.StatusOK
+
+	texts := make([]string, len(pages))
+	for i, page := range pages {
+		texts[i] = page.Text
+	}
+	result.ContentHash = contentHash(strings.Join(texts, "\n"), opts)
+	if previous.ContentHash == result.ContentHash && len(previous.Offices) > 0 && len(pages) == len(previous.SourceURLs) {
+		log.Printf("content unchanged for %s, reusing %d offices", previous.Bioguide, len(previous.Offices))
+		result.Offices = previous.Offices
+		result.SourceURLs = previous.SourceURLs
+		result.Unchanged = true
+		result.Status = StatusOK
+		return true, nil
+	}
+
+	offices, sources, err := extractFromPages(ctx, pages, opts)
+	if err != nil && ctx.Err() != nil {
+		result.Status = StatusLLMError
+		return false, err
+	}
+	if len(offices) == 0 {
+		return false, nil
+	}
+
+	result.Offices = dedupeOffices(offices)
+	result.SourceURLs = sources
+	result.Status = StatusOK
+	return true, nil
+}
+
+// discoverOffices extracts offices from the likeliest office pages linked from or listed in the
+// sitemap of the page we started on, since plenty of members split their offices across a page
+// per district office. Pages that fail are skipped, the error is only returned when nothing was
+// found at all
+func discoverOffices(ctx context.Context, contentURL, html string, fetch func(string) (string, error), opts findOptions) ([]OfficeInfo, []string, error) {
+	candidates := discoverOfficePages(ctx, contentURL, html, opts.DiscoverPages)
+	if len(candidates) == 0 {
+		return nil, nil, nil
+	}
+	log.Printf("found %d candidate office pages for %s: %v", len(candidates), contentURL, candidates)
+
+	return extractFromPages(ctx, fetchPages(ctx, candidates, fetch, opts), opts)
+}
+
+type fetchedPage struct {
+	URL  string
+	HTML string
+	Text string
+}
+
+// fetchPages fetches each page and reduces it to text, skipping the ones that fail
+func fetchPages(ctx context.Context, urls []string, fetch func(string) (string, error), opts findOptions) []fetchedPage {
+	var pages []fetchedPage
+	for _, pageURL := range urls {
+		if ctx.Err() != nil {
+			break
 		}
 
-		htmlText, err := html2text.FromString(string(html), html2text.Options{TextOnly: true})
+		pageHTML, err := fetch(pageURL)
+		if err != nil {
+			log.Printf("skipping office page %s: %v", pageURL, err)
+			continue
+		}
+		text, err := pageText(pageURL, pageHTML, opts)
 		if err != nil {
-			return offices, fmt.Errorf("can't parse html to string: %s", err)
+			log.Printf("skipping office page %s: %v", pageURL, err)
+			continue
+		}
+		pages = append(pages, fetchedPage{URL: pageURL, HTML: pageHTML, Text: text})
+	}
+
+	return pages
+}
+
+// pageText reduces a page to the text we extract offices from, pruning the boilerplate first
+// unless that's turned off
+func pageText(pageURL, html string, opts findOptions) (string, error) {
+	pruned := html
+	if opts.Prune {
+		pruned = pruneBoilerplate(html)
+	}
+
+	text, err := html2text.FromString(pruned, html2text.Options{TextOnly: true})
+	if err != nil {
+		return "", fmt.Errorf("can't parse html to string: %s", err)
+	}
+
+	if opts.DebugPrune {
+		unpruned := text
+		if opts.Prune {
+			unpruned, err = html2text.FromString(html, html2text.Options{TextOnly: true})
+			if err != nil {
+				return "", fmt.Errorf("can't parse html to string: %s", err)
+			}
+		}
+		log.Printf("pruned %s from %d to %d bytes of html and %d to %d estimated tokens of text", pageURL, len(html), len(pruned), estimateTokens(unpruned), estimateTokens(text))
+	}
+
+	return text, nil
+}
+
+// extractFromPages extracts offices from each page, returning them along with the pages they came
+// from. The error is only returned when nothing was found at all
+func extractFromPages(ctx context.Context, pages []fetchedPage, opts findOptions) ([]OfficeInfo, []string, error) {
+	var offices []OfficeInfo
+	var sources []string
+	var lastErr error
+	for _, page := range pages {
+		if ctx.Err() != nil {
+			lastErr = ctx.Err()
+			break
 		}
 
-		addressResponse, err := getOpenAIResponse(ADDRESS_PROMPT, htmlText, true)
+		found, err := extractOffices(ctx, page.URL, page.HTML, page.Text, opts)
 		if err != nil {
-			return offices, err
+			log.Printf("couldn't extract offices from %s: %v", page.URL, err)
+			lastErr = err
+			continue
+		}
+		log.Printf("found %d offices on %s", len(found), page.URL)
+		if len(found) > 0 {
+			offices = append(offices, found...)
+			sources = append(sources, page.URL)
 		}
+	}
 
-		offices, err := marshalOffliceList(addressResponse)
+	if len(offices) == 0 {
+		return nil, nil, lastErr
+	}
 
+	return offices, sources, nil
+}
+
+// extractOffices pulls the offices out of a single page, checks them against the page content and
+// adds any coordinates from the page's maps
+func extractOffices(ctx context.Context, contentURL, html, htmlText string, opts findOptions) ([]OfficeInfo, error) {
+	offices, err := extractUnverifiedOffices(ctx, contentURL, html, htmlText, opts)
+	if err != nil {
 		return offices, err
 	}
 
-	return offices, err
-}
-
-func getOpenAIResponse(prompt, content string, structuredOutput bool) (string, error) {
-	request := openai.ChatCompletionRequest{
-		Model: openai.GPT4oMini,
-		Messages: []openai.ChatCompletionMessage{
-			{
-				Role:    openai.ChatMessageRoleSystem,
-				Content: prompt,
-			},
-			{
-				Role:    openai.ChatMessageRoleUser,
-				Content: content,
-			},
-		},
-	}
-
-	// when asking for json formatted information, providing a schema makes the resulting data much
-	// more reliable without having to add too much extra prompt text
-	if structuredOutput {
-		request.ResponseFormat = &openai.ChatCompletionResponseFormat{
-			Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
-			JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
-				Strict: true,
-				Name:   "address_response",
-				Schema: jsonschema.Definition{
-					Type: jsonschema.Object,
-					Properties: map[string]jsonschema.Definition{
-						"addresses": {
-							Type: jsonschema.Array,
-							Items: &jsonschema.Definition{
-								Type: jsonschema.Object,
-								Properties: map[string]jsonschema.Definition{
-									"address": {
-										Type:        jsonschema.String,
-										Description: "The street address of the office",
-									},
-									"city": {
-										Type:        jsonschema.String,
-										Description: "The city where the office is located",
-									},
-									"state": {
-										Type:        jsonschema.String,
-										Description: "The state where the office is located",
-									},
-									"zip": {
-										Type:        jsonschema.String,
-										Description: "The ZIP code of the office",
-									},
-									"phone": {
-										Type:        jsonschema.String,
-										Description: "The phone number of the office",
-									},
-									"fax": {
-										Type:        jsonschema.String,
-										Description: "The fax number of the office",
-									},
-									"suite": {
-										Type:        jsonschema.String,
-										Description: "The suite number or floor of the office",
-									},
-									"building": {
-										Type:        jsonschema.String,
-										Description: "The building that the office is in",
-									},
-								},
-								Required:             []string{"address", "city", "state", "zip", "phone", "fax", "suite", "building"},
-								AdditionalProperties: false,
-							},
-						},
-					},
-					Required:             []string{"addresses"},
-					AdditionalProperties: false,
-				},
-			},
-		}
-	}
-
-	resp, err := openaiClient.CreateChatCompletion(
-		context.Background(),
-		request,
-	)
+	offices = verifyOffices(contentURL, offices, html, htmlText, opts.Verify)
+	for i := range offices {
+		structureOfficeHours(&offices[i])
+	}
+
+	return attachMapCoordinates(offices, html), nil
+}
+
+// extractUnverifiedOffices pulls the offices out of a single page, from structured data if the
+// page has enough of it and from the llm otherwise
+func extractUnverifiedOffices(ctx context.Context, contentURL, html, htmlText string, opts findOptions) ([]OfficeInfo, error) {
+	var structured []OfficeInfo
+	// structured offices that the page's other offices are added to
+	var partial []OfficeInfo
+	if opts.StructuredData != StructuredOff {
+		structured = extractStructuredOffices(html)
+		if len(structured) > 0 && opts.StructuredData != StructuredCheck {
+			if !structuredLooksComplete(structured) {
+				log.Printf("only %d offices in structured data at %s, looking for more", len(structured), contentURL)
+				partial = structured
+			} else {
+				log.Printf("using %d offices from structured data at %s", len(structured), contentURL)
+				return structured, nil
+			}
+		}
+	}
+
+	if opts.Extractor == ExtractorHeuristic {
+		return dedupeOffices(append(partial, extractHeuristicOffices(htmlText)...)), nil
+	}
+
+	offices, err := extractLLMOffices(ctx, contentURL, htmlText, opts.ChunkTokens)
+	if err != nil {
+		if !canFallBackToHeuristics(ctx, err) {
+			return nil, err
+		}
+		// the rules aren't as good as the llm but are better than nothing
+		heuristic := extractHeuristicOffices(htmlText)
+		if len(heuristic) > 0 {
+			log.Printf("llm failed for %s, using %d heuristic offices: %v", contentURL, len(heuristic), err)
+			return dedupeOffices(append(partial, heuristic...)), nil
+		}
+		if len(partial) > 0 {
+			log.Printf("llm failed for %s, using %d offices from structured data: %v", contentURL, len(partial), err)
+			return partial, nil
+		}
+		return nil, err
+	}
+
+	if len(structured) > 0 {
+		compareOffices(contentURL, "structured data", structured, "llm", offices)
+	}
+	if opts.Extractor == ExtractorCheck {
+		compareOffices(contentURL, "llm", offices, "heuristic", extractHeuristicOffices(htmlText))
+	}
+
+	return dedupeOffices(append(partial, offices...)), nil
+}
+
+// structuredLooksComplete guesses whether a page's structured data lists all its offices. Sites
+// often publish a single address for the whole organization, usually the DC office, and list the
+// district offices only in the page text
+func structuredLooksComplete(offices []OfficeInfo) bool {
+	if len(offices) < 2 {
+		return false
+	}
+	for _, office := range offices {
+		if formatState(office.State) != "DC" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// extractLLMOffices asks the llm for the offices in some page text, a chunk at a time for long
+// pages
+func extractLLMOffices(ctx context.Context, contentURL, htmlText string, chunkTokens int) ([]OfficeInfo, error) {
+	chunks := splitIntoChunks(htmlText, chunkTokens)
+	if len(chunks) > 1 {
+		log.Printf("splitting %s into %d chunks of about %d tokens", contentURL, len(chunks), chunkTokens)
+	}
+
+	var offices []OfficeInfo
+	for _, chunk := range chunks {
+		addressResponse, err := getLLMResponse(ctx, ADDRESS_PROMPT, chunk, addressResponseSchema)
+		if err != nil {
+			return nil, err
+		}
+		chunkOffices, err := marshalOffliceList(addressResponse)
+		if err != nil {
+			return nil, err
+		}
+		offices = append(offices, chunkOffices...)
+	}
+
+	if len(chunks) == 1 {
+		return offices, nil
+	}
+	return mergeChunkOffices(offices), nil
+}
+
+// bump this when changes to the code that extracts or cleans up offices mean unchanged pages
+// should be extracted again, like when hours were added
+const extractionRevision = 2
+
+// extractionVersion identifies everything besides the page that decides what extraction finds, so
+// a new prompt, schema or extractor setting counts as a change even when the page hasn't changed
+func extractionVersion(opts findOptions) string {
+	schema, _ := json.Marshal(addressResponseSchema)
+	return fmt.Sprintf("%d|%s|%s|%s|%s|%s|%s|%t|%d", extractionRevision, ADDRESS_PROMPT, schema,
+		opts.Extractor, opts.StructuredData, opts.Verify, opts.Discover, opts.Prune, opts.ChunkTokens)
+}
+
+// contentHash hashes page text with whitespace collapsed, so reformatting alone doesn't count as
+// a change, along with the extraction version
+func contentHash(text string, opts findOptions) string {
+	return hashString(extractionVersion(opts) + "\n" + strings.Join(strings.Fields(text), " "))
+}
+
+func getLLMResponse(ctx context.Context, prompt, content string, schema *ResponseSchema) (string, error) {
+	err := limits.waitForLLM(ctx, estimateTokens(prompt)+estimateTokens(content))
+	if err != nil {
+		return "", err
+	}
+
+	// start the timeout after waiting on the rate limits, it covers any retries though
+	ctx, cancel := context.WithTimeout(ctx, llmTimeout)
+	defer cancel()
+
+	completion, err := llmProvider.Complete(ctx, prompt, content, schema)
+	if usage := usageFromContext(ctx); usage != nil {
+		usage.Add(completion.Usage)
+	}
+	spending.add(completion.Usage)
+
+	return completion.Content, err
+}
+
+type locationsResponse struct {
+	URL string `json:"url"`
+}
+
+// resolveLocationsURL turns the llm's pick of offices page into an absolute url on the member's
+// site. Models return relative links, quoted links and sometimes links to other sites, only the
+// first two are any use to us
+func resolveLocationsURL(contentURL, response string) (string, error) {
+	var locations locationsResponse
+	err := json.Unmarshal([]byte(response), &locations)
+	if err != nil {
+		return "", fmt.Errorf("can't parse locations response: %v", err)
+	}
+	if strings.TrimSpace(locations.URL) == "" {
+		return "", fmt.Errorf("no locations url on the page")
+	}
+
+	base, err := url.Parse(contentURL)
 	if err != nil {
 		return "", err
 	}
+	resolved, ok := resolveSiteURL(base, locations.URL)
+	if !ok {
+		return "", fmt.Errorf("rejecting locations url %q, it isn't on %s", locations.URL, base.Host)
+	}
+	if normalizePageURL(resolved) == normalizePageURL(contentURL) {
+		return "", fmt.Errorf("locations url %q is the page we started from", locations.URL)
+	}
 
-	return resp.Choices[0].Message.Content, nil
+	return resolved, nil
 }
 
 type OpenAIOfficeResponse struct {
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestFindAddressesWithFakeProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><body><p>100 Main Street, Suite 200</p><p>Springfield, IL 62701</p></body></html>`)
+	}))
+	defer server.Close()
+
+	fake := &FakeProvider{Responses: map[string]string{
+		ADDRESS_PROMPT: `{"addresses":[{"address":"100 Main Street","suite":"200","city":"Springfield","state":"IL","zip":"62701","phone":"","fax":"","building":""}]}`,
+	}}
+	llmProvider = fake
+
+	result, err := findAddresses(context.Background(), server.URL, nil, findOptions{})
+	if err != nil {
+		t.Fatalf("findAddresses() error = %v", err)
+	}
+	if len(result.Offices) != 1 || result.Offices[0].City != "Springfield" || result.Offices[0].Suite != "200" {
+		t.Errorf("findAddresses() = %+v, expected one Springfield office", result.Offices)
+	}
+	if fake.Calls != 1 {
+		t.Errorf("expected 1 llm call, got %d", fake.Calls)
+	}
+
+	// a second run against the same content should reuse the previous offices without extracting
+	previous := &OfficeList{Offices: result.Offices, ContentHash: result.ContentHash}
+	result, err = findAddresses(context.Background(), server.URL, previous, findOptions{})
+	if err != nil {
+		t.Fatalf("findAddresses() error = %v", err)
+	}
+	if !result.Unchanged || len(result.Offices) != 1 {
+		t.Errorf("expected unchanged content to reuse offices, got %+v", result)
+	}
+	if fake.Calls != 1 {
+		t.Errorf("expected unchanged content to skip the llm, got %d calls", fake.Calls)
+	}
+
+	// different extraction settings are a change even when the page isn't
+	result, err = findAddresses(context.Background(), server.URL, previous, findOptions{Verify: VerifyOff})
+	if err != nil {
+		t.Fatalf("findAddresses() error = %v", err)
+	}
+	if result.Unchanged || fake.Calls != 2 || result.ContentHash == previous.ContentHash {
+		t.Errorf("expected new extraction settings to extract again, got %+v after %d calls", result, fake.Calls)
+	}
+
+	// heuristic results aren't kept past the next run
+	result, err = findAddresses(context.Background(), server.URL, nil, findOptions{Extractor: ExtractorHeuristic})
+	if err != nil {
+		t.Fatalf("findAddresses() error = %v", err)
+	}
+	if len(result.Offices) != 1 || result.ContentHash != "" {
+		t.Errorf("expected heuristic offices without a content hash, got %+v", result)
+	}
+}
+
+func TestNormalizeHost(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"https://pelosi.house.gov", "pelosi.house.gov"},
+		{"http://www.Pelosi.house.gov/", "pelosi.house.gov"},
+		{"https://pelosi.house.gov/contact/offices", "pelosi.house.gov"},
+		{"pelosi.house.gov", "pelosi.house.gov"},
+	}
+
+	for _, tc := range testCases {
+		result := normalizeHost(tc.input)
+		if result != tc.expected {
+			t.Errorf("normalizeHost(%q) = %q, expected %q", tc.input, result, tc.expected)
+		}
+	}
+
+	if normalizePageURL("https://www.pelosi.house.gov/") != normalizePageURL("http://pelosi.house.gov") {
+		t.Errorf("expected a trailing slash, www. and scheme not to matter for the same page")
+	}
+	if normalizePageURL("https://pelosi.house.gov/contact") == normalizePageURL("https://pelosi.house.gov") {
+		t.Errorf("expected a subpage to differ from the homepage")
+	}
+}
+
+func TestResolveLocationsURL(t *testing.T) {
+	testCases := []struct {
+		response string
+		expected string
+		ok       bool
+	}{
+		{`{"url":"/offices"}`, "https://pelosi.house.gov/offices", true},
+		{`{"url":"\"https://pelosi.house.gov/contact/locations\""}`, "https://pelosi.house.gov/contact/locations", true},
+		{`{"url":"https://www.house.gov/representatives"}`, "", false},
+		{`{"url":"https://pelosi.house.gov/"}`, "", false},
+		{`{"url":""}`, "", false},
+		{`The offices are listed at /offices`, "", false},
+	}
+
+	for _, tc := range testCases {
+		result, err := resolveLocationsURL("https://pelosi.house.gov", tc.response)
+		if result != tc.expected || (err == nil) != tc.ok {
+			t.Errorf("resolveLocationsURL(%q) = %q, %v, expected %q", tc.response, result, err, tc.expected)
+		}
+	}
+}
+
+func TestFindAddressesStartsFromRememberedPages(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	homepageFetches := 0
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		homepageFetches++
+		fmt.Fprint(w, `<html><body><a href="/offices">Our Offices</a></body></html>`)
+	})
+	mux.HandleFunc("/offices", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><body><p>100 Main Street</p><p>Springfield, IL 62701</p><p>(217) 555-0100</p></body></html>`)
+	})
+
+	opts := findOptions{Extractor: ExtractorHeuristic, StructuredData: StructuredOff, Verify: VerifyOff, Discover: DiscoverFallback, DiscoverPages: 3}
+	result, err := findAddresses(context.Background(), server.URL, nil, opts)
+	if err != nil {
+		t.Fatalf("findAddresses() error = %v", err)
+	}
+	if len(result.SourceURLs) != 1 || result.SourceURLs[0] != server.URL+"/offices" {
+		t.Fatalf("expected the offices page to be remembered, got %v", result.SourceURLs)
+	}
+
+	// the next run goes straight to the offices page
+	homepageFetches = 0
+	previous := &OfficeList{Bioguide: "X000001", Offices: result.Offices, SourceURLs: result.SourceURLs}
+	result, err = findAddresses(context.Background(), server.URL, previous, opts)
+	if err != nil {
+		t.Fatalf("findAddresses() error = %v", err)
+	}
+	if len(result.Offices) != 1 || homepageFetches != 0 {
+		t.Errorf("expected 1 office without fetching the homepage, got %+v and %d homepage fetches", result.Offices, homepageFetches)
+	}
+
+	// and when that page goes away it starts over from the homepage
+	previous.SourceURLs = []string{server.URL + "/old-offices"}
+	result, err = findAddresses(context.Background(), server.URL, previous, opts)
+	if err != nil {
+		t.Fatalf("findAddresses() error = %v", err)
+	}
+	if len(result.Offices) != 1 || result.SourceURLs[0] != server.URL+"/offices" || homepageFetches != 1 {
+		t.Errorf("expected offices rediscovered from the homepage, got %+v from %v", result.Offices, result.SourceURLs)
+	}
+}
+
+func TestPreviousForScrape(t *testing.T) {
+	previous := []OfficeList{{Bioguide: "A000001", ContentHash: "abc", SourceURLs: []string{"https://a.house.gov/offices"}, Offices: []OfficeInfo{{City: "Springfield"}}}}
+
+	byBioguide := previousForScrape(previous, false)
+	if byBioguide["A000001"].ContentHash != "abc" {
+		t.Errorf("expected the content hash to be kept, got %+v", byBioguide["A000001"])
+	}
+
+	// forcing skips the unchanged page shortcut but still starts from the remembered pages
+	byBioguide = previousForScrape(previous, true)
+	if leg := byBioguide["A000001"]; leg.ContentHash != "" || len(leg.SourceURLs) != 1 {
+		t.Errorf("expected force to drop only the content hash, got %+v", leg)
+	}
+	if previous[0].ContentHash != "abc" {
+		t.Errorf("expected the previous results to be left alone")
+	}
+}
+
+// cancellingProvider is a fake provider that cancels the run once it's answered some requests,
+// like someone hitting ctrl-c part way through
+type cancellingProvider struct {
+	FakeProvider
+	after  int
+	cancel context.CancelFunc
+}
+
+func (p *cancellingProvider) Complete(ctx context.Context, prompt, content string, schema *ResponseSchema) (Completion, error) {
+	completion, err := p.FakeProvider.Complete(ctx, prompt, content, schema)
+	if p.Calls >= p.after {
+		p.cancel()
+	}
+	return completion, err
+}
+
+// inTempDir runs the rest of a test in an empty directory, since scrapes read and write files in
+// the current one
+func inTempDir(t *testing.T) string {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	return dir
+}
+
+// fakeLegislators serves a legislator list with the given bioguides, each with a site of their own
+// on the same server that lists one new office
+func fakeLegislators(t *testing.T, bioguides ...string) {
+	var list strings.Builder
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	for _, bioguide := range bioguides {
+		fmt.Fprintf(&list, "- id: {bioguide: %s}\n  terms: [{type: rep, start: '2025-01-03', end: '2999-01-03', state: IL, url: '%s/%s'}]\n", bioguide, server.URL, bioguide)
+		mux.HandleFunc("/"+bioguide, func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `<html><body><p>100 New Street</p><p>Springfield, IL 62701</p></body></html>`)
+		})
+	}
+	mux.HandleFunc("/legislators.yaml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, list.String())
+	})
+
+	url := legislatorsURL
+	legislatorsURL = server.URL + "/legislators.yaml"
+	t.Cleanup(func() { legislatorsURL = url })
+}
+
+func TestScrapeAllURLsInterrupted(t *testing.T) {
+	bioguides := []string{"A000001", "B000002", "C000003"}
+	fakeLegislators(t, bioguides...)
+
+	var previous []OfficeList
+	for _, bioguide := range bioguides {
+		previous = append(previous, OfficeList{Bioguide: bioguide, Offices: []OfficeInfo{{Address: "1 Old Street", City: "Springfield", State: "IL", Zip: "62701"}}})
+	}
+
+	testCases := []struct {
+		name           string
+		previous       []OfficeList
+		minLegislators int
+		written        string
+		kept           int
+	}{
+		{"enough to replace offices.json", previous, 1, OfficesFile, 2},
+		{"too few for offices.json", []OfficeList{}, 3, PartialOfficesFile, 0},
+	}
+
+	for _, tc := range testCases {
+		inTempDir(t)
+		err := writeOfficeList(OfficesFile, tc.previous)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		llmProvider = &cancellingProvider{
+			FakeProvider: FakeProvider{Responses: map[string]string{
+				ADDRESS_PROMPT: `{"addresses":[{"address":"100 New Street","city":"Springfield","state":"IL","zip":"62701"}]}`,
+			}},
+			after:  1,
+			cancel: cancel,
+		}
+		err = scrapeAllURLs(ctx, scrapeOptions{MinLegislators: tc.minLegislators, Workers: 1, ReportPath: "report", Find: findOptions{Discover: DiscoverOff, Verify: VerifyOff}})
+		cancel()
+		if err == nil {
+			t.Errorf("%s: expected an error for the interrupted run", tc.name)
+		}
+
+		written, err := readOfficeList(tc.written)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		// the one legislator done before the interruption has new offices, and everyone the run
+		// didn't get to keeps their old ones
+		scraped, kept := 0, 0
+		for _, leg := range written {
+			switch {
+			case len(leg.Offices) == 1 && leg.Offices[0].Address == "100 New Street":
+				scraped++
+			case len(leg.Offices) == 1 && leg.Offices[0].Address == "1 Old Street":
+				kept++
+			}
+		}
+		if len(written) != 1+tc.kept || scraped != 1 || kept != tc.kept {
+			t.Errorf("%s: expected 1 scraped and %d kept legislators in %s, got %+v", tc.name, tc.kept, tc.written, written)
+		}
+
+		// the report still lists the legislators the run never got to
+		data, err := os.ReadFile("report.json")
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		var report RunReport
+		json.Unmarshal(data, &report)
+		if len(report.Legislators) != 3 || report.Counts[StatusOK] != 1 || report.Counts[StatusSkipped] != 2 {
+			t.Errorf("%s: expected 1 ok and 2 skipped legislators in the report, got %+v", tc.name, report.Counts)
+		}
+
+		// the journal is left for -resume
+		if _, err := os.Stat(JournalFile); err != nil {
+			t.Errorf("%s: expected the journal to be kept: %v", tc.name, err)
+		}
+	}
+}
+
+func TestScrapeAllURLsSpendingCap(t *testing.T) {
+	defer func(s *spendTracker) { spending = s }(spending)
+
+	testCases := []struct {
+		name        string
+		bioguides   []string
+		interrupted bool
+	}{
+		// the one legislator goes over the cap but nobody was left out
+		{"crossed by the last legislator", []string{"A000001"}, false},
+		{"legislators left out", []string{"A000001", "B000002", "C000003"}, true},
+	}
+
+	for _, tc := range testCases {
+		inTempDir(t)
+		fakeLegislators(t, tc.bioguides...)
+		// every request costs more than the whole budget
+		spending = newSpendTracker(ModelPrice{PromptPerMillion: 1e6}, 0.01)
+		llmProvider = &FakeProvider{Responses: map[string]string{
+			ADDRESS_PROMPT: `{"addresses":[{"address":"100 New Street","city":"Springfield","state":"IL","zip":"62701"}]}`,
+		}}
+
+		err := scrapeAllURLs(context.Background(), scrapeOptions{MinLegislators: 1, Workers: 1, Find: findOptions{Discover: DiscoverOff, Verify: VerifyOff}})
+		if (err != nil) != tc.interrupted {
+			t.Errorf("%s: scrapeAllURLs() error = %v, expected interrupted %t", tc.name, err, tc.interrupted)
+		}
+		_, err = os.Stat(JournalFile)
+		if kept := err == nil; kept != tc.interrupted {
+			t.Errorf("%s: journal kept %t, expected %t", tc.name, kept, tc.interrupted)
+		}
+	}
+}
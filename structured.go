@@ -0,0 +1,308 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// modes for how structured data on a page is used relative to the llm
+const (
+	// use structured data when a page has enough of it and skip the llm, otherwise add the llm's offices to it
+	StructuredFirst = "first"
+	// always run the llm, and log where it disagrees with structured data
+	StructuredCheck = "check"
+	// ignore structured data
+	StructuredOff = "off"
+)
+
+// extractStructuredOffices finds schema.org PostalAddress data published in JSON-LD blocks or
+// microdata attributes. This is free and deterministic compared to asking the llm, but only some
+// member sites bother to publish it
+func extractStructuredOffices(source string) []OfficeInfo {
+	doc, err := html.Parse(strings.NewReader(source))
+	if err != nil {
+		return nil
+	}
+
+	var offices []OfficeInfo
+	var walk func(n *html.Node, scopes []*html.Node)
+	walk = func(n *html.Node, scopes []*html.Node) {
+		if n.Type == html.ElementNode {
+			if n.Data == "script" && strings.EqualFold(attr(n, "type"), "application/ld+json") && n.FirstChild != nil {
+				offices = append(offices, officesFromJSONLD(n.FirstChild.Data)...)
+				return
+			}
+
+			if hasAttr(n, "itemscope") {
+				if isSchemaType(attr(n, "itemtype"), "PostalAddress") {
+					var parent *html.Node
+					if len(scopes) > 0 {
+						parent = scopes[len(scopes)-1]
+					}
+					offices = append(offices, officeFromMicrodata(n, parent))
+					return
+				}
+				scopes = append(scopes, n)
+			}
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c, scopes)
+		}
+	}
+	walk(doc, nil)
+
+	// sites sometimes publish the same address as both json-ld and microdata
+	return dedupeOffices(offices)
+}
+
+func officesFromJSONLD(data string) []OfficeInfo {
+	var parsed interface{}
+	err := json.Unmarshal([]byte(data), &parsed)
+	if err != nil {
+		return nil
+	}
+
+	var offices []OfficeInfo
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch value := v.(type) {
+		case []interface{}:
+			for _, item := range value {
+				walk(item)
+			}
+		case map[string]interface{}:
+			if isJSONLDType(value, "PostalAddress") {
+				offices = append(offices, officeFromJSONLDAddress(value, nil))
+				return
+			}
+
+			// an organization or place with an address, phone numbers usually live on this object
+			// rather than on the address itself
+			if address, ok := value["address"]; ok {
+				for _, a := range asList(address) {
+					if addressMap, ok := a.(map[string]interface{}); ok {
+						offices = append(offices, officeFromJSONLDAddress(addressMap, value))
+					}
+				}
+			}
+
+			// walk keys in order so offices come out in the same order every run
+			keys := make([]string, 0, len(value))
+			for key := range value {
+				if key != "address" {
+					keys = append(keys, key)
+				}
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				walk(value[key])
+			}
+		}
+	}
+	walk(parsed)
+
+	return offices
+}
+
+func officeFromJSONLDAddress(address, parent map[string]interface{}) OfficeInfo {
+	street, suite := splitSuite(jsonString(address["streetAddress"]))
+	office := OfficeInfo{
+		Address: street,
+		Suite:   suite,
+		City:    jsonString(address["addressLocality"]),
+		State:   jsonString(address["addressRegion"]),
+		Zip:     jsonString(address["postalCode"]),
+		Phone:   jsonString(address["telephone"]),
+		Fax:     jsonString(address["faxNumber"]),
+	}
+	if parent != nil {
+		if office.Phone == "" {
+			office.Phone = jsonString(parent["telephone"])
+		}
+		if office.Fax == "" {
+			office.Fax = jsonString(parent["faxNumber"])
+		}
+		var hours []string
+		for _, value := range asList(parent["openingHours"]) {
+			hours = append(hours, jsonString(value))
+		}
+		office.Hours = schemaOpeningHours(hours)
+	}
+
+	return office
+}
+
+// officeFromMicrodata reads the itemprops within a PostalAddress itemscope, with phone numbers
+// from the enclosing scope if the address doesn't have its own
+func officeFromMicrodata(address, parent *html.Node) OfficeInfo {
+	props := microdataProps(address)
+	street, suite := splitSuite(props["streetAddress"])
+	office := OfficeInfo{
+		Address: street,
+		Suite:   suite,
+		City:    props["addressLocality"],
+		State:   props["addressRegion"],
+		Zip:     props["postalCode"],
+		Phone:   props["telephone"],
+		Fax:     props["faxNumber"],
+	}
+	if parent != nil {
+		parentProps := microdataProps(parent)
+		if office.Phone == "" {
+			office.Phone = parentProps["telephone"]
+		}
+		if office.Fax == "" {
+			office.Fax = parentProps["faxNumber"]
+		}
+		if parentProps["openingHours"] != "" {
+			office.Hours = schemaOpeningHours([]string{parentProps["openingHours"]})
+		}
+	}
+
+	return office
+}
+
+// microdataProps collects the itemprop values belonging to a scope, without descending into
+// nested scopes
+func microdataProps(scope *html.Node) map[string]string {
+	props := map[string]string{}
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			if name := attr(c, "itemprop"); name != "" {
+				if _, exists := props[name]; !exists {
+					props[name] = microdataValue(c)
+				}
+			}
+			if !hasAttr(c, "itemscope") {
+				walk(c)
+			}
+		}
+	}
+	walk(scope)
+
+	return props
+}
+
+func microdataValue(n *html.Node) string {
+	switch n.Data {
+	case "meta":
+		return strings.TrimSpace(attr(n, "content"))
+	case "a", "link":
+		if href := attr(n, "href"); strings.HasPrefix(href, "tel:") {
+			return strings.TrimPrefix(href, "tel:")
+		}
+	}
+
+	return strings.Join(strings.Fields(nodeText(n)), " ")
+}
+
+func nodeText(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		sb.WriteString(nodeText(c))
+		sb.WriteString(" ")
+	}
+
+	return sb.String()
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+
+	return ""
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isSchemaType(itemtype, schemaType string) bool {
+	return strings.HasSuffix(strings.TrimRight(itemtype, "/"), "schema.org/"+schemaType)
+}
+
+func isJSONLDType(value map[string]interface{}, schemaType string) bool {
+	for _, t := range asList(value["@type"]) {
+		if s, ok := t.(string); ok && (s == schemaType || isSchemaType(s, schemaType)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func asList(v interface{}) []interface{} {
+	if list, ok := v.([]interface{}); ok {
+		return list
+	}
+	if v == nil {
+		return nil
+	}
+
+	return []interface{}{v}
+}
+
+func jsonString(v interface{}) string {
+	switch value := v.(type) {
+	case string:
+		return strings.TrimSpace(value)
+	case []interface{}:
+		if len(value) > 0 {
+			return jsonString(value[0])
+		}
+	}
+
+	return ""
+}
+
+// compareOffices logs offices that only one of two extraction methods found, to flag pages where
+// the llm may have missed or made up an office
+func compareOffices(contentURL, nameA string, a []OfficeInfo, nameB string, b []OfficeInfo) int {
+	inA := map[string]bool{}
+	for _, office := range a {
+		inA[officeInfoKey(office)] = true
+	}
+	inB := map[string]bool{}
+	for _, office := range b {
+		inB[officeInfoKey(office)] = true
+	}
+
+	disagreements := 0
+	for _, office := range a {
+		if !inB[officeInfoKey(office)] {
+			log.Printf("%s: %s found %s, %s but %s didn't", contentURL, nameA, office.Address, office.City, nameB)
+			disagreements++
+		}
+	}
+	for _, office := range b {
+		if !inA[officeInfoKey(office)] {
+			log.Printf("%s: %s found %s, %s but %s didn't", contentURL, nameB, office.Address, office.City, nameA)
+			disagreements++
+		}
+	}
+
+	return disagreements
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExtractStructuredOffices(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want []OfficeInfo
+	}{
+		{
+			name: "JSON-LD with phone on the organization",
+			html: `<html><head><script type="application/ld+json">
+				{"@context":"https://schema.org","@type":"GovernmentOffice","telephone":"(217) 555-0100",
+				"address":{"@type":"PostalAddress","streetAddress":"100 Main Street, Suite 200","addressLocality":"Springfield","addressRegion":"IL","postalCode":"62701"}}
+				</script></head><body></body></html>`,
+			want: []OfficeInfo{
+				{Address: "100 Main Street", Suite: "Suite 200", City: "Springfield", State: "IL", Zip: "62701", Phone: "(217) 555-0100"},
+			},
+		},
+		{
+			name: "Microdata with tel link",
+			html: `<div itemscope itemtype="https://schema.org/GovernmentOffice">
+				<div itemprop="address" itemscope itemtype="https://schema.org/PostalAddress">
+					<span itemprop="streetAddress">5 Elm Ave</span>
+					<span itemprop="addressLocality">Peoria</span>, <span itemprop="addressRegion">IL</span>
+					<span itemprop="postalCode">61602</span>
+				</div>
+				<a itemprop="telephone" href="tel:309-555-0199">Call us</a>
+			</div>`,
+			want: []OfficeInfo{
+				{Address: "5 Elm Ave", City: "Peoria", State: "IL", Zip: "61602", Phone: "309-555-0199"},
+			},
+		},
+		{
+			name: "No structured data",
+			html: `<p>100 Main Street, Springfield, IL 62701</p>`,
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := extractStructuredOffices(tt.html)
+			if len(got) != len(tt.want) {
+				t.Fatalf("extractStructuredOffices() = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("extractStructuredOffices()[%d] = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestStructuredDataFirst(t *testing.T) {
+	jsonLD := func(offices ...string) string {
+		return `<script type="application/ld+json">[` + strings.Join(offices, ",") + `]</script>`
+	}
+	dc := `{"@type":"GovernmentOffice","address":{"@type":"PostalAddress","streetAddress":"1 Independence Ave SE","addressLocality":"Washington","addressRegion":"DC","postalCode":"20515"}}`
+	springfield := `{"@type":"GovernmentOffice","address":{"@type":"PostalAddress","streetAddress":"100 Main Street","addressLocality":"Springfield","addressRegion":"IL","postalCode":"62701"}}`
+	text := "1 Independence Ave SE, Washington, DC 20515\n100 Main Street, Springfield, IL 62701\n200 Elm Street, Peoria, IL 61602"
+
+	testCases := []struct {
+		name     string
+		html     string
+		llmCalls int
+		expected []string
+	}{
+		// the page's other offices are only in its text
+		{"only the dc office", jsonLD(dc), 1, []string{"Washington", "Peoria"}},
+		{"dc and a district office", jsonLD(dc, springfield), 0, []string{"Washington", "Springfield"}},
+	}
+
+	for _, tc := range testCases {
+		fake := &FakeProvider{Responses: map[string]string{
+			ADDRESS_PROMPT: `{"addresses":[{"address":"200 Elm Street","suite":"","city":"Peoria","state":"IL","zip":"61602","phone":"","fax":"","building":""}]}`,
+		}}
+		llmProvider = fake
+
+		offices, err := extractUnverifiedOffices(context.Background(), "test", tc.html, text, findOptions{StructuredData: StructuredFirst})
+		if err != nil {
+			t.Fatalf("%s: extractUnverifiedOffices() error = %v", tc.name, err)
+		}
+		var cities []string
+		for _, office := range offices {
+			cities = append(cities, office.City)
+		}
+		if !reflect.DeepEqual(cities, tc.expected) || fake.Calls != tc.llmCalls {
+			t.Errorf("%s: got offices in %v with %d llm calls, expected %v with %d", tc.name, cities, fake.Calls, tc.expected, tc.llmCalls)
+		}
+	}
+}
@@ -43,7 +43,13 @@ type YAMLOffice struct {
 	Phone     string  `yaml:"phone,omitempty"`
 }
 
-func upstreamChanges() error {
+// upstreamOptions holds the settings for generating the upstream yaml
+type upstreamOptions struct {
+	// add offices that failed verification too, which are otherwise left out
+	IncludeUnverified bool
+}
+
+func upstreamChanges(opts upstreamOptions) error {
 	officesData, err := os.ReadFile("offices.json")
 	if err != nil {
 		return fmt.Errorf("error reading offices.json: %v", err)
@@ -72,6 +78,28 @@ func upstreamChanges() error {
 		return fmt.Errorf("error parsing YAML data: %v", err)
 	}
 
+	legislators = applyOfficeList(legislators, officeList, opts)
+
+	updatedYAML, err := yaml.Marshal(legislators)
+	if err != nil {
+		return fmt.Errorf("error marshaling updated YAML data: %v", err)
+	}
+
+	// we want single quoted strings for zips and numeric IDs so replace them all here
+	singleQuotedUpdatedYAML := strings.ReplaceAll(string(updatedYAML), `"`, `'`)
+
+	err = os.WriteFile("updated_legislators-district-offices.yaml", []byte(singleQuotedUpdatedYAML), 0644)
+	if err != nil {
+		return fmt.Errorf("error writing updated YAML file: %v", err)
+	}
+
+	fmt.Println("Updated YAML file has been created: updated_legislators-district-offices.yaml")
+	return nil
+}
+
+// applyOfficeList updates the upstream offices with the ones in offices.json. Offices that match
+// keep their ids, offices that are gone are removed and new ones are added
+func applyOfficeList(legislators []YAMLLegislatorOffices, officeList []OfficeList, opts upstreamOptions) []YAMLLegislatorOffices {
 	statsNewOffices := 0
 	statsRemovedOffices := 0
 	statsNewLegislators := 0
@@ -102,6 +130,16 @@ func upstreamChanges() error {
 					for j := len(genOfficesCopy) - 1; j >= 0; j-- {
 						if officeEquals(legislators[li].Offices[i], genOfficesCopy[j]) {
 							isFound = true
+							// hours change more often than addresses, keep them current
+							if hours := officeHoursText(genOfficesCopy[j]); hours != "" && normalizeHours(legislators[li].Offices[i].Hours) != hours {
+								log.Printf("updating hours in %s to %s", legislators[li].Offices[i].City, hours)
+								legislators[li].Offices[i].Hours = hours
+							}
+							// existing offices keep their details but gain coordinates they were missing
+							if legislators[li].Offices[i].Latitude == 0 && pinpointed(genOfficesCopy[j]) {
+								legislators[li].Offices[i].Latitude = genOfficesCopy[j].Latitude
+								legislators[li].Offices[i].Longitude = genOfficesCopy[j].Longitude
+							}
 							genOfficesCopy = append(genOfficesCopy[:j], genOfficesCopy[j+1:]...)
 						}
 					}
@@ -123,6 +161,9 @@ func upstreamChanges() error {
 						}
 					}
 
+					if skipUnverified(remainingGenOffice, opts) {
+						continue
+					}
 					log.Printf("adding office in %s", remainingGenOffice.City)
 					statsNewOffices++
 					legislators[li].Offices = append(legislators[li].Offices, officeFromGenOffice(remainingGenOffice, legislators[li].ID.Bioguide, legislators[li].Offices))
@@ -153,6 +194,9 @@ func upstreamChanges() error {
 				if strings.ToLower(office.City) == "washington" || strings.ToLower(office.State) == "d.c." || strings.ToLower(office.State) == "dc" {
 					continue
 				}
+				if skipUnverified(office, opts) {
+					continue
+				}
 				newLegislator.Offices = append(newLegislator.Offices, officeFromGenOffice(office, generatedOffices.Bioguide, newLegislator.Offices))
 				statsNewOffices++
 			}
@@ -163,21 +207,22 @@ func upstreamChanges() error {
 
 	log.Printf("found %d new offices, removed %d old offices, added %d new legislators", statsNewOffices, statsRemovedOffices, statsNewLegislators)
 
-	updatedYAML, err := yaml.Marshal(legislators)
-	if err != nil {
-		return fmt.Errorf("error marshaling updated YAML data: %v", err)
-	}
-
-	// we want single quoted strings for zips and numeric IDs so replace them all here
-	singleQuotedUpdatedYAML := strings.ReplaceAll(string(updatedYAML), `"`, `'`)
+	return legislators
+}
 
-	err = os.WriteFile("updated_legislators-district-offices.yaml", []byte(singleQuotedUpdatedYAML), 0644)
-	if err != nil {
-		return fmt.Errorf("error writing updated YAML file: %v", err)
+// skipUnverified reports whether a new office should be left out of the upstream yaml because
+// its details couldn't be found on the page it came from
+func skipUnverified(office OfficeInfo, opts upstreamOptions) bool {
+	if office.Verification == nil || office.Verification.Verified {
+		return false
+	}
+	if !opts.IncludeUnverified {
+		log.Printf("skipping unverified office in %s, missing %s", office.City, strings.Join(office.Verification.Missing, ", "))
+		return true
 	}
 
-	fmt.Println("Updated YAML file has been created: updated_legislators-district-offices.yaml")
-	return nil
+	log.Printf("adding unverified office in %s, missing %s", office.City, strings.Join(office.Verification.Missing, ", "))
+	return false
 }
 
 func cityKey(city string) string {
@@ -205,17 +250,26 @@ func officeEquals(office YAMLOffice, genOffice OfficeInfo) bool {
 // note that we need the existing offices to return cases where the offices are in the same city and
 // have keys like `philadelphia-1`, `philadelphia-2`
 func officeFromGenOffice(genOffice OfficeInfo, bioguide string, existingOffices []YAMLOffice) YAMLOffice {
-	return YAMLOffice{
-		ID:       nextOfficeKey(bioguide, genOffice.City, existingOffices),
-		Address:  genOffice.Address,
-		City:     genOffice.City,
-		Suite:    formatSuite(genOffice.Suite),
-		Building: genOffice.Building,
-		Zip:      genOffice.Zip,
-		State:    formatState(genOffice.State),
-		Phone:    formatPhone(genOffice.Phone),
-		Fax:      formatPhone(genOffice.Fax),
+	office := YAMLOffice{
+		ID:        nextOfficeKey(bioguide, genOffice.City, existingOffices),
+		Address:   genOffice.Address,
+		City:      genOffice.City,
+		Suite:     formatSuite(genOffice.Suite),
+		Building:  genOffice.Building,
+		Zip:       genOffice.Zip,
+		State:     formatState(genOffice.State),
+		Phone:     formatPhone(genOffice.Phone),
+		Fax:       formatPhone(genOffice.Fax),
+		Hours:     officeHoursText(genOffice),
+		Latitude:  genOffice.Latitude,
+		Longitude: genOffice.Longitude,
 	}
+	// estimated coordinates stay in offices.json
+	if !pinpointed(genOffice) {
+		office.Latitude, office.Longitude = 0, 0
+	}
+
+	return office
 }
 
 // nextOfficeKey generates subsequent city keys for duplicates like philadelphia-1, philadelphia-2, etc
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -250,3 +251,77 @@ func TestNextOfficeKey(t *testing.T) {
 		})
 	}
 }
+
+func TestApplyOfficeListUnverified(t *testing.T) {
+	officeList := []OfficeList{{Bioguide: "A000001", Offices: []OfficeInfo{
+		{Address: "100 Main Street", City: "Springfield", State: "IL", Zip: "62701", Verification: &OfficeVerification{Verified: true}},
+		{Address: "250 Oak Street", City: "Peoria", State: "IL", Zip: "61602", Verification: &OfficeVerification{Missing: []string{"zip"}}},
+	}}}
+
+	testCases := []struct {
+		name     string
+		opts     upstreamOptions
+		expected []string
+	}{
+		{"skipped by default", upstreamOptions{}, []string{"Springfield"}},
+		{"included on request", upstreamOptions{IncludeUnverified: true}, []string{"Springfield", "Peoria"}},
+	}
+
+	for _, tc := range testCases {
+		// one existing legislator and one new one, so both ways of adding offices are covered
+		legislators := []YAMLLegislatorOffices{{}}
+		legislators[0].ID.Bioguide = "A000001"
+		newList := append(officeList, OfficeList{Bioguide: "B000002", Offices: officeList[0].Offices})
+
+		updated := applyOfficeList(legislators, newList, tc.opts)
+		if len(updated) != 2 {
+			t.Fatalf("%s: expected 2 legislators, got %d", tc.name, len(updated))
+		}
+		for _, leg := range updated {
+			var cities []string
+			for _, office := range leg.Offices {
+				cities = append(cities, office.City)
+			}
+			if !reflect.DeepEqual(cities, tc.expected) {
+				t.Errorf("%s: %s got offices in %v, expected %v", tc.name, leg.ID.Bioguide, cities, tc.expected)
+			}
+		}
+	}
+}
+
+func TestApplyOfficeListCoordinates(t *testing.T) {
+	offices := []OfficeInfo{
+		{Address: "100 Main Street", City: "Springfield", State: "IL", Zip: "62701", Latitude: 39.8017, Longitude: -89.6436, GeoPrecision: GeoPrecisionRooftop},
+		{Address: "200 Elm Street", City: "Peoria", State: "IL", Zip: "61602", Latitude: 40.6936, Longitude: -89.5890},
+		{Address: "300 Oak Street", City: "Decatur", State: "IL", Zip: "62523", Latitude: 39.8400, Longitude: -88.9500, GeoPrecision: GeoPrecisionZipCentroid},
+		{Address: "400 Pine Street", City: "Champaign", State: "IL", Zip: "61820", Latitude: 40.1100, Longitude: -88.2400, GeoPrecision: GeoPrecisionStreetRange},
+	}
+	// coordinates before precision was recorded came from map links and are kept
+	expected := map[string][2]float64{
+		"Springfield": {39.8017, -89.6436},
+		"Peoria":      {40.6936, -89.5890},
+		"Decatur":     {0, 0},
+		"Champaign":   {0, 0},
+	}
+
+	// existing offices without coordinates and new offices are both held to the same precision
+	legislators := []YAMLLegislatorOffices{{}}
+	legislators[0].ID.Bioguide = "A000001"
+	legislators[0].Offices = []YAMLOffice{
+		{ID: "A000001-springfield", Address: "100 Main Street", City: "Springfield", State: "IL", Zip: "62701"},
+		{ID: "A000001-decatur", Address: "300 Oak Street", City: "Decatur", State: "IL", Zip: "62523"},
+	}
+	officeList := []OfficeList{{Bioguide: "A000001", Offices: offices}, {Bioguide: "B000002", Offices: offices}}
+
+	updated := applyOfficeList(legislators, officeList, upstreamOptions{})
+	for _, leg := range updated {
+		if len(leg.Offices) != len(offices) {
+			t.Fatalf("%s: expected %d offices, got %d", leg.ID.Bioguide, len(offices), len(leg.Offices))
+		}
+		for _, office := range leg.Offices {
+			if office.Latitude != expected[office.City][0] || office.Longitude != expected[office.City][1] {
+				t.Errorf("%s: office in %s got %v,%v, expected %v,%v", leg.ID.Bioguide, office.City, office.Latitude, office.Longitude, expected[office.City][0], expected[office.City][1])
+			}
+		}
+	}
+}
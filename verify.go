@@ -0,0 +1,116 @@
+package main
+
+import (
+	"log"
+	"regexp"
+	"strings"
+)
+
+// what to do with offices whose details can't be found on the page they came from
+const (
+	// keep them, with the verification result recorded in offices.json
+	VerifyFlag = "flag"
+	// leave them out of the results entirely
+	VerifyDrop = "drop"
+	// don't check at all
+	VerifyOff = "off"
+)
+
+// OfficeVerification records whether the key details of an extracted office actually appear in
+// the source page, which catches offices the llm made up or garbled
+type OfficeVerification struct {
+	Verified bool `json:"verified"`
+	// which of phone, fax, zip or street_number couldn't be found
+	Missing []string `json:"missing,omitempty"`
+}
+
+var (
+	zipRegex          = regexp.MustCompile(`\b\d{5}\b`)
+	numberRegex       = regexp.MustCompile(`\b\d+\b`)
+	telLinkRegex      = regexp.MustCompile(`href\s*=\s*["']?tel:([^"'\s>]+)`)
+	streetNumberRegex = regexp.MustCompile(`^(?i:p\.?\s*o\.?\s*box\s+)?(\d+)`)
+	// "ext. 5", "extension 12", "x5" or ";ext=5" at the end of a number
+	phoneExtensionRegex = regexp.MustCompile(`(?i)\s*(?:[,;]?\s*(?:ext\.?|extension|x)\s*[.:=#]?\s*\d+)\s*$`)
+	nonDigitRegex       = regexp.MustCompile(`\D`)
+)
+
+// verifyOffices checks each office against the page's visible text and structured data, recording
+// the result on the office. With VerifyDrop any office that fails is removed
+func verifyOffices(contentURL string, offices []OfficeInfo, html, htmlText, mode string) []OfficeInfo {
+	if mode == VerifyOff {
+		return offices
+	}
+
+	// only text a visitor can see counts, numbers in scripts and attributes could be anything.
+	// The one exception is tel: links, which are often the only place a phone number is written
+	phones := map[string]bool{}
+	for _, phone := range phoneRegex.FindAllString(htmlText, -1) {
+		phones[phoneDigits(phone)] = true
+	}
+	for _, link := range telLinkRegex.FindAllStringSubmatch(html, -1) {
+		phones[phoneDigits(link[1])] = true
+	}
+	zips := map[string]bool{}
+	for _, zip := range zipRegex.FindAllString(htmlText, -1) {
+		zips[zip] = true
+	}
+	numbers := map[string]bool{}
+	for _, number := range numberRegex.FindAllString(htmlText, -1) {
+		numbers[number] = true
+	}
+	// the page's schema.org data counts too, it's published for exactly this kind of reader and
+	// json-ld is never visible
+	for _, office := range extractStructuredOffices(html) {
+		for _, phone := range []string{office.Phone, office.Fax} {
+			if phone != "" {
+				phones[phoneDigits(phone)] = true
+			}
+		}
+		if zip := strings.TrimSpace(office.Zip); len(zip) >= 5 {
+			zips[zip[:5]] = true
+		}
+		if number := streetNumberRegex.FindStringSubmatch(strings.TrimSpace(office.Address)); number != nil {
+			numbers[number[1]] = true
+		}
+	}
+
+	var verified []OfficeInfo
+	for _, office := range offices {
+		var missing []string
+		if office.Phone != "" && !phones[phoneDigits(office.Phone)] {
+			missing = append(missing, "phone")
+		}
+		if office.Fax != "" && !phones[phoneDigits(office.Fax)] {
+			missing = append(missing, "fax")
+		}
+		if zip := strings.TrimSpace(office.Zip); len(zip) >= 5 && !zips[zip[:5]] {
+			missing = append(missing, "zip")
+		}
+		if number := streetNumberRegex.FindStringSubmatch(strings.TrimSpace(office.Address)); number != nil && !numbers[number[1]] {
+			missing = append(missing, "street_number")
+		}
+
+		office.Verification = &OfficeVerification{Verified: len(missing) == 0, Missing: missing}
+		if len(missing) > 0 {
+			log.Printf("%s: couldn't verify %s for office at %s, %s", contentURL, strings.Join(missing, ", "), office.Address, office.City)
+			if mode == VerifyDrop {
+				continue
+			}
+		}
+		verified = append(verified, office)
+	}
+
+	return verified
+}
+
+// phoneDigits reduces a phone number to its last ten digits so formatting and a leading +1 don't
+// matter when comparing. Extensions are dropped first so they aren't mistaken for the number
+func phoneDigits(phone string) string {
+	phone = phoneExtensionRegex.ReplaceAllString(phone, "")
+	digits := nonDigitRegex.ReplaceAllString(phone, "")
+	if len(digits) > 10 {
+		digits = digits[len(digits)-10:]
+	}
+
+	return digits
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestVerifyOffices(t *testing.T) {
+	html := `<p>100 Main Street</p><p>Springfield, IL 62701</p><a href="tel:+12175550100">Call</a>`
+	text := "100 Main Street\nSpringfield, IL 62701\nCall"
+
+	offices := []OfficeInfo{
+		{Address: "100 Main Street", City: "Springfield", State: "IL", Zip: "62701", Phone: "(217) 555-0100"},
+		{Address: "250 Oak Street", City: "Springfield", State: "IL", Zip: "62704", Phone: "(217) 555-0199"},
+	}
+
+	flagged := verifyOffices("test", offices, html, text, VerifyFlag)
+	if len(flagged) != 2 {
+		t.Fatalf("expected flag mode to keep both offices, got %d", len(flagged))
+	}
+	if !flagged[0].Verification.Verified {
+		t.Errorf("expected first office to verify, got %+v", flagged[0].Verification)
+	}
+	if flagged[1].Verification.Verified || !reflect.DeepEqual(flagged[1].Verification.Missing, []string{"phone", "zip", "street_number"}) {
+		t.Errorf("expected second office to be missing phone, zip and street number, got %+v", flagged[1].Verification)
+	}
+
+	dropped := verifyOffices("test", offices, html, text, VerifyDrop)
+	if len(dropped) != 1 || dropped[0].Address != "100 Main Street" {
+		t.Errorf("expected drop mode to keep only the verified office, got %+v", dropped)
+	}
+}
+
+func TestVerifyOfficesIgnoresMarkup(t *testing.T) {
+	// the zip and street number are only in attributes and scripts, which a visitor never sees
+	html := `<div data-zip="62704" data-street="250"><p>Oak Street office</p><a href="tel:217-555-0199">Call</a></div><script>var office = {number: 250, zip: "62704"}</script>`
+	text := "Oak Street office\nCall"
+
+	offices := verifyOffices("test", []OfficeInfo{{Address: "250 Oak Street", City: "Springfield", State: "IL", Zip: "62704", Phone: "(217) 555-0199 ext. 5"}}, html, text, VerifyFlag)
+	if !reflect.DeepEqual(offices[0].Verification.Missing, []string{"zip", "street_number"}) {
+		t.Errorf("expected zip and street number to be missing, got %+v", offices[0].Verification)
+	}
+}
+
+func TestPhoneDigits(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"(202) 225-1234", "2022251234"},
+		{"+1 202.225.1234", "2022251234"},
+		{"(202) 225-1234 ext. 5", "2022251234"},
+		{"202-225-1234 x105", "2022251234"},
+		{"202-225-1234, extension 12", "2022251234"},
+		{"+12022251234;ext=5", "2022251234"},
+	}
+
+	for _, tc := range testCases {
+		if result := phoneDigits(tc.input); result != tc.expected {
+			t.Errorf("phoneDigits(%q) = %q, expected %q", tc.input, result, tc.expected)
+		}
+	}
+}
+
+func TestVerifyStructuredOffices(t *testing.T) {
+	// the office's details are only in json-ld, which is as verifiable as a page gets
+	html := `<html><head><script type="application/ld+json">{"@type":"GovernmentOffice","telephone":"(217) 555-0100",
+"address":{"@type":"PostalAddress","streetAddress":"100 Main Street","addressLocality":"Springfield","addressRegion":"IL","postalCode":"62701"}}</script></head>
+<body><p>Visit our Springfield office</p></body></html>`
+	text := "Visit our Springfield office"
+
+	offices, err := extractOffices(context.Background(), "test", html, text, findOptions{StructuredData: StructuredFirst, Extractor: ExtractorHeuristic, Verify: VerifyFlag})
+	if err != nil {
+		t.Fatalf("extractOffices() error = %v", err)
+	}
+	if len(offices) != 1 || offices[0].Verification == nil || !offices[0].Verification.Verified {
+		t.Errorf("expected the structured office to verify, got %+v", offices)
+	}
+
+	// an office the llm made up isn't verified by someone else's structured data
+	made := verifyOffices("test", []OfficeInfo{{Address: "250 Oak Street", City: "Springfield", State: "IL", Zip: "62704", Phone: "(217) 555-0199"}}, html, text, VerifyFlag)
+	if !reflect.DeepEqual(made[0].Verification.Missing, []string{"phone", "zip", "street_number"}) {
+		t.Errorf("expected a made up office to fail verification, got %+v", made[0].Verification)
+	}
+}